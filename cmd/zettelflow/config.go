@@ -28,6 +28,7 @@ func initConfig() {
 	viper.SetConfigType("yaml")
 
 	viper.AutomaticEnv() // read in environment variables that match
+	setDefaults()
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
@@ -35,6 +36,50 @@ func initConfig() {
 	}
 }
 
+// setDefaults registers fallbacks for settings that older config files may not contain.
+func setDefaults() {
+	viper.SetDefault("paths.manifest", "~/.local/share/zettelflow/manifest.json")
+	viper.SetDefault("paths.journal", "~/.local/share/zettelflow/journal")
+	viper.SetDefault("paths.folgezettel", "~/.local/share/zettelflow/folgezettel.json")
+	viper.SetDefault("ingest.max_input_chars", 12000)
+	viper.SetDefault("ingest.max_file_size_mb", 25)
+	viper.SetDefault("ingest.raw_cleanup", true)
+	viper.SetDefault("naming.scheme", "timestamp")
+	viper.SetDefault("split.strategy", "delimiter")
+	viper.SetDefault("split.delimiter", "###")
+	viper.SetDefault("split.heading_level", 2)
+	viper.SetDefault("split.sentences", 5)
+	viper.SetDefault("split.max_tokens", 300)
+	viper.SetDefault("split.overlap", 30)
+	viper.SetDefault("split.template", "note_header")
+	viper.SetDefault("split.ids", "file")
+	viper.SetDefault("split.folgezettel_start", 1)
+	viper.SetDefault("split.structure_note", false)
+	viper.SetDefault("split.clean", true)
+	viper.SetDefault("split.stream_threshold_mb", 16)
+	viper.SetDefault("split.title", "auto")
+	viper.SetDefault("split.hashtags", true)
+	viper.SetDefault("split.strip_heading", true)
+	viper.SetDefault("split.semantic.method", "llm")
+	viper.SetDefault("split.semantic.model", "gpt-4o-mini")
+	viper.SetDefault("split.semantic.embedding_model", "text-embedding-3-small")
+	viper.SetDefault("split.semantic.threshold", 1.0)
+	viper.SetDefault("split.semantic.min_sentences", 2)
+	viper.SetDefault("watch.debounce", "2s")
+	viper.SetDefault("enrich.backend", "llm")
+	viper.SetDefault("enrich.local.max_tags", 5)
+}
+
+// expandPath replaces a leading ~ in a configured path with the user's home directory.
+func expandPath(path string) string {
+	if path == "" || path[0] != '~' {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	cobra.CheckErr(err)
+	return filepath.Join(home, path[1:])
+}
+
 // checkAPIKey ensures that the OpenAI API key is set, prompting the user if it's not.
 func checkAPIKey() {
 	if !viper.IsSet("llm.api_key") || viper.GetString("llm.api_key") == "" {
@@ -2,14 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 
-	openai "github.com/sashabaranov/go-openai"
 	"github.com/pterm/pterm"
+	openai "github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -20,139 +21,193 @@ var enrichCmd = &cobra.Command{
 	Long:  `Processes all notes in the split directory, calls an LLM for each, and saves the results.`,
 	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		checkAPIKey()
+		backend := viper.GetString("enrich.backend")
+		if cmd.Flags().Changed("backend") {
+			backend, _ = cmd.Flags().GetString("backend")
+		}
+		if backend != "llm" && backend != "local" {
+			pterm.Error.Printf("Error: unknown enrich backend '%s' (expected 'llm' or 'local').\n", backend)
+			os.Exit(1)
+		}
+		if backend == "llm" {
+			checkAPIKey()
+		}
 		pterm.DefaultBox.WithTitle("Enrich Stage").Println("Starting enrichment process...")
 
 		// Print settings
 		pterm.DefaultSection.Println("Using Enrich Settings")
-		leveledList := pterm.LeveledList{
-			{Level: 0, Text: fmt.Sprintf("Model: %s", viper.GetString("enrich.model"))},
-			{Level: 0, Text: fmt.Sprintf("Temperature: %f", viper.GetFloat64("enrich.temperature"))},
-			{Level: 0, Text: fmt.Sprintf("Max Tokens: %d", viper.GetInt("enrich.max_completion_tokens"))},
-			{Level: 0, Text: fmt.Sprintf("Parallel Workers: %d", viper.GetInt("enrich.parallel"))},
+		leveledList := pterm.LeveledList{{Level: 0, Text: fmt.Sprintf("Backend: %s", backend)}}
+		if backend == "llm" {
+			leveledList = append(leveledList,
+				pterm.LeveledListItem{Level: 0, Text: fmt.Sprintf("Model: %s", viper.GetString("enrich.model"))},
+				pterm.LeveledListItem{Level: 0, Text: fmt.Sprintf("Temperature: %f", viper.GetFloat64("enrich.temperature"))},
+				pterm.LeveledListItem{Level: 0, Text: fmt.Sprintf("Max Tokens: %d", viper.GetInt("enrich.max_completion_tokens"))},
+			)
+		} else {
+			leveledList = append(leveledList,
+				pterm.LeveledListItem{Level: 0, Text: fmt.Sprintf("Max Tags: %d", viper.GetInt("enrich.local.max_tags"))},
+			)
 		}
+		leveledList = append(leveledList,
+			pterm.LeveledListItem{Level: 0, Text: fmt.Sprintf("Parallel Workers: %d", viper.GetInt("enrich.parallel"))},
+		)
 		pterm.DefaultTree.WithRoot(pterm.NewTreeFromLeveledList(leveledList)).Render()
 		pterm.Println() // for spacing
-		splitPath := viper.GetString("paths.split")
-		if splitPath[0] == '~' {
-			home, err := os.UserHomeDir()
-			cobra.CheckErr(err)
-			splitPath = filepath.Join(home, splitPath[1:])
-		}
+		cobra.CheckErr(enrichPending(backend, nil))
+		pterm.Success.Println("Enrich stage complete.")
+		os.Exit(0)
+	},
+}
 
-		enrichPath := viper.GetString("paths.enrich")
-		if enrichPath[0] == '~' {
-			home, err := os.UserHomeDir()
-			cobra.CheckErr(err)
-			enrichPath = filepath.Join(home, enrichPath[1:])
+// enrichPending fills in the frontmatter of the notes in the split directory with the
+// given backend and saves the results to the enrich directory. If only is not nil, just
+// the notes at those paths are enriched.
+func enrichPending(backend string, only []string) error {
+	splitPath := expandPath(viper.GetString("paths.split"))
+	enrichPath := expandPath(viper.GetString("paths.enrich"))
+
+	files, err := ioutil.ReadDir(splitPath)
+	if err != nil {
+		return err
+	}
+
+	filesToProcess := []os.FileInfo{}
+	selected := map[string]bool{}
+	for _, path := range only {
+		selected[filepath.Base(path)] = true
+	}
+	for _, file := range files {
+		if !file.IsDir() && (only == nil || selected[file.Name()]) {
+			filesToProcess = append(filesToProcess, file)
 		}
-
-		files, err := ioutil.ReadDir(splitPath)
-		cobra.CheckErr(err)
-
-		filesToProcess := []os.FileInfo{}
-		for _, file := range files {
-			if !file.IsDir() {
-				filesToProcess = append(filesToProcess, file)
-			}
+	}
+
+	if len(filesToProcess) == 0 {
+		pterm.Info.Println("No notes to enrich in the split directory.")
+		return nil
+	}
+
+	var enrichNote func(content string) (string, error)
+	if backend == "local" {
+		// Weight keywords against the notes waiting in split and the already enriched vault.
+		corpus := newKeywordCorpus(viper.GetString("split.output_extension"), splitPath, enrichPath)
+		maxTags := viper.GetInt("enrich.local.max_tags")
+		enrichNote = func(content string) (string, error) {
+			return localEnrich(content, corpus, maxTags)
+		}
+	} else {
+		enrichNote, err = newLLMEnricher()
+		if err != nil {
+			return err
 		}
+	}
 
-		if len(filesToProcess) == 0 {
-			pterm.Info.Println("No notes to enrich in the split directory.")
-			os.Exit(0)
+	titles := map[string]string{} // enriched note names to their titles, for the structure notes
+	for _, file := range filesToProcess {
+		expectedExt := viper.GetString("split.output_extension")
+		if filepath.Ext(file.Name()) != expectedExt {
+			continue
 		}
 
-		// Load the enrich prompt
-		promptPath := viper.GetString("paths.prompts")
-		if promptPath[0] == '~' {
-			home, err := os.UserHomeDir()
-			cobra.CheckErr(err)
-			promptPath = filepath.Join(home, promptPath[1:])
+		pterm.Info.Printf("Processing note: %s\n", file.Name())
+		filePath := filepath.Join(splitPath, file.Name())
+		originalContent, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return err
 		}
-		promptFile := filepath.Join(promptPath, "default_enrich.md")
-		promptTemplate, err := ioutil.ReadFile(promptFile)
-		cobra.CheckErr(err)
 
-		client := openai.NewClient(viper.GetString("llm.api_key"))
-		model := viper.GetString("enrich.model")
-		if model == "" {
-			pterm.Error.Println("Error: enrich model is not defined in the configuration.")
-			os.Exit(1)
+		// 1 & 2. Produce the new frontmatter from the backend, keeping the note's provenance.
+		newYAML, err := enrichNote(string(originalContent))
+		if err != nil {
+			return fmt.Errorf("enriching %s: %w", file.Name(), err)
+		}
+		if merged, err := carryProvenance(string(originalContent), newYAML); err != nil {
+			pterm.Warning.Printf("  - Enriched frontmatter is not valid YAML, provenance not carried over: %v\n", err)
+		} else {
+			newYAML = merged
 		}
 
-		for _, file := range filesToProcess {
-			expectedExt := viper.GetString("split.output_extension")
-			if filepath.Ext(file.Name()) != expectedExt {
-				continue
-			}
+		// 3. ISOLATE the original body content
+		_, bodyStr := splitFrontmatter(string(originalContent))
 
-			pterm.Info.Printf("Processing note: %s\n", file.Name())
-			filePath := filepath.Join(splitPath, file.Name())
-			originalContent, err := ioutil.ReadFile(filePath)
-			cobra.CheckErr(err)
-
-			// 1. Send the ENTIRE original content to the LLM
-			finalPrompt := strings.Replace(string(promptTemplate), "{content}", string(originalContent), -1)
-			req := openai.ChatCompletionRequest{
-				Model:               model,
-				Temperature:         float32(viper.GetFloat64("enrich.temperature")),
-				MaxCompletionTokens: viper.GetInt("enrich.max_completion_tokens"),
-				Messages: []openai.ChatCompletionMessage{
-					{
-						Role:    openai.ChatMessageRoleUser,
-						Content: finalPrompt,
-					},
-				},
-			}
-			resp, err := client.CreateChatCompletion(context.Background(), req)
-			cobra.CheckErr(err)
+		// 4. Combine the new YAML with the original body
+		finalContent := fmt.Sprintf("---\n%s\n---\n%s", newYAML, bodyStr)
 
-			llmResponse := resp.Choices[0].Message.Content
+		// 5. Save the final file
+		fileName := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())) + viper.GetString("split.output_extension")
+		outputPath := filepath.Join(enrichPath, fileName)
+		err = writeFileAtomic(outputPath, []byte(finalContent))
+		if err != nil {
+			return err
+		}
+		if err := derived(filePath, outputPath, []byte(finalContent)); err != nil {
+			return err
+		}
+		pterm.Success.Printf("  - Saved enriched note to: %s\n", outputPath)
+		if fields, err := parseFrontmatter(newYAML); err == nil {
+			titles[strings.TrimSuffix(fileName, filepath.Ext(fileName))] = headerValue(fields, "title")
+		}
+	}
+	return refreshStructureNotes(enrichPath, titles)
+}
 
-			// 2. ISOLATE the YAML from the LLM's response.
-			var llmYAML string
-			if start := strings.Index(llmResponse, "---"); start != -1 {
-				if end := strings.Index(llmResponse[start+3:], "---"); end != -1 {
-					llmYAML = llmResponse[start+3 : start+3+end]
-				}
-			}
-			if llmYAML == "" {
-				llmYAML = llmResponse
-			}
-			llmYAML = strings.TrimSpace(llmYAML)
-
-			// 3. ISOLATE the original body content
-			bodyStr := ""
-			separator := "\n---\n"
-			if strings.HasPrefix(string(originalContent), "---") {
-				endOfFrontmatter := strings.Index(string(originalContent)[3:], separator)
-				if endOfFrontmatter != -1 {
-					endOfFrontmatter += 3
-					bodyStr = string(originalContent)[endOfFrontmatter+len(separator):]
-				}
-			}
-			if bodyStr == "" {
-				bodyStr = string(originalContent)
-			}
+// newLLMEnricher loads the enrich prompt and returns a function that sends a note to the
+// LLM and isolates the YAML frontmatter from its response.
+func newLLMEnricher() (func(content string) (string, error), error) {
+	promptPath := expandPath(viper.GetString("paths.prompts"))
+	promptFile := filepath.Join(promptPath, "default_enrich.md")
+	promptTemplate, err := ioutil.ReadFile(promptFile)
+	if err != nil {
+		return nil, err
+	}
+
+	client := openai.NewClient(viper.GetString("llm.api_key"))
+	model := viper.GetString("enrich.model")
+	if model == "" {
+		return nil, errors.New("enrich model is not defined in the configuration")
+	}
+
+	return func(content string) (string, error) {
+		// Send the ENTIRE original content to the LLM
+		finalPrompt := strings.Replace(string(promptTemplate), "{content}", content, -1)
+		req := openai.ChatCompletionRequest{
+			Model:               model,
+			Temperature:         float32(viper.GetFloat64("enrich.temperature")),
+			MaxCompletionTokens: viper.GetInt("enrich.max_completion_tokens"),
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: finalPrompt,
+				},
+			},
+		}
+		resp, err := client.CreateChatCompletion(context.Background(), req)
+		if err != nil {
+			return "", err
+		}
+		if len(resp.Choices) == 0 {
+			return "", errors.New("the LLM returned no choices")
+		}
 
-			// 4. Combine the new YAML from the LLM with the original body
-			finalContent := fmt.Sprintf("---\n%s\n---\n%s", llmYAML, bodyStr)
+		llmResponse := resp.Choices[0].Message.Content
 
-			// 5. Save the final file
-			fileName := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())) + viper.GetString("split.output_extension")
-			outputPath := filepath.Join(enrichPath, fileName)
-			err = ioutil.WriteFile(outputPath, []byte(finalContent), 0644)
-			cobra.CheckErr(err)
-			pterm.Success.Printf("  - Saved enriched note to: %s\n", outputPath)
+		// ISOLATE the YAML from the LLM's response.
+		var llmYAML string
+		if start := strings.Index(llmResponse, "---"); start != -1 {
+			if end := strings.Index(llmResponse[start+3:], "---"); end != -1 {
+				llmYAML = llmResponse[start+3 : start+3+end]
+			}
 		}
-		pterm.Success.Println("Enrich stage complete.")
-		os.Exit(0)
-	},
+		if llmYAML == "" {
+			llmYAML = llmResponse
+		}
+		return strings.TrimSpace(llmYAML), nil
+	}, nil
 }
 
 func init() {
 	rootCmd.AddCommand(enrichCmd)
 	enrichCmd.Flags().Int("parallel", 4, "Number of parallel workers")
 	enrichCmd.Flags().String("filter", "", "Filter notes to enrich (e.g., tag==todo)")
+	enrichCmd.Flags().String("backend", "llm", "Enrich backend: 'llm' or 'local' (offline TF-IDF keywords)")
 }
-
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// keywordCorpus holds document frequencies for every term in the vault, used to weight
+// the terms of a single note against everything else the user has written.
+type keywordCorpus struct {
+	docs int
+	df   map[string]int
+}
+
+// newKeywordCorpus builds document frequencies from every note with the given extension
+// in the listed directories. Missing directories are ignored.
+func newKeywordCorpus(ext string, dirs ...string) *keywordCorpus {
+	corpus := &keywordCorpus{df: map[string]int{}}
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			if file.IsDir() || filepath.Ext(file.Name()) != ext {
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(dir, file.Name()))
+			if err != nil {
+				continue
+			}
+			_, body := splitFrontmatter(string(content))
+			corpus.add(body)
+		}
+	}
+	return corpus
+}
+
+// add counts each distinct term of text once towards its document frequency.
+func (c *keywordCorpus) add(text string) {
+	seen := map[string]bool{}
+	for _, term := range keywordTerms(wikilinkPattern.ReplaceAllString(text, " ")) {
+		if !seen[term] {
+			seen[term] = true
+			c.df[term]++
+		}
+	}
+	c.docs++
+}
+
+// idf returns the smoothed inverse document frequency of a term.
+func (c *keywordCorpus) idf(term string) float64 {
+	return math.Log(float64(c.docs+1)/float64(c.df[term]+1)) + 1
+}
+
+// localEnrich fills in the title and tags of a note without calling an LLM. A title the
+// note already has, such as the heading split took it from, is kept. The note's existing
+// frontmatter is kept as the template for the result, so the output has the same shape
+// as an LLM-enriched note.
+func localEnrich(content string, corpus *keywordCorpus, maxTags int) (string, error) {
+	frontmatter, body := splitFrontmatter(content)
+	fields, err := parseFrontmatter(frontmatter)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(headerValue(fields, "title")) == "" {
+		setFrontmatterField(fields, "title", stringNode(deriveTitle(body)))
+	}
+	setFrontmatterField(fields, "tags", stringListNode(extractKeywords(body, corpus, maxTags)))
+	return marshalFrontmatter(fields)
+}
+
+var (
+	headingPattern  = regexp.MustCompile(`(?m)^[ \t]{0,3}#{1,6}[ \t]+(.+?)[ \t]*#*[ \t]*$`)
+	headingMarker   = regexp.MustCompile(`(?m)^[ \t]{0,3}#{1,6}([ \t]|$)`)
+	sentenceEnd     = regexp.MustCompile(`[.!?](\s|$)`)
+	markdownCruft   = regexp.MustCompile("[*_`>\\[\\]]+")
+	phraseSeparator = regexp.MustCompile(`[.,;:!?()\[\]{}"“”\n]+`)
+	wikilinkPattern = regexp.MustCompile(`\[\[[^\]\n]*\]\]`)
+)
+
+// deriveTitle uses the first Markdown heading of a note outside code, falling back to its
+// first sentence.
+func deriveTitle(body string) string {
+	for _, m := range headingPattern.FindAllStringSubmatch(codeFence.ReplaceAllString(body, ""), -1) {
+		if title := strings.TrimSpace(markdownCruft.ReplaceAllString(m[1], "")); title != "" {
+			return title
+		}
+	}
+	return firstSentence(body)
+}
+
+// truncateWords shortens s to at most max bytes, cutting at a word boundary, or else at a
+// character boundary.
+func truncateWords(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := strings.LastIndex(s[:max], " ")
+	if cut <= 0 {
+		cut = max
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+	}
+	return strings.TrimSpace(s[:cut]) + "…"
+}
+
+// extractKeywords combines RAKE-style key phrases with TF-IDF weighted single terms and
+// returns up to max tags in kebab-case. Wikilinks, such as the navigation line written by
+// split, name other notes and are not keywords of this one.
+func extractKeywords(body string, corpus *keywordCorpus, max int) []string {
+	body = wikilinkPattern.ReplaceAllString(body, " ")
+	terms := keywordTerms(body)
+	if len(terms) == 0 || max <= 0 {
+		return []string{}
+	}
+
+	tf := map[string]float64{}
+	for _, term := range terms {
+		tf[term]++
+	}
+	weight := map[string]float64{}
+	for term, count := range tf {
+		weight[term] = count / float64(len(terms)) * corpus.idf(term)
+	}
+
+	type candidate struct {
+		words []string
+		score float64
+	}
+	var candidates []candidate
+	seen := map[string]bool{}
+	for _, phrase := range rakePhrases(body) {
+		key := strings.Join(phrase, " ")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		score := 0.0
+		for _, w := range phrase {
+			score += weight[w]
+		}
+		// Multi-word phrases only count if they recur; one-off word runs are usually noise.
+		if len(phrase) > 1 && strings.Count(strings.ToLower(body), key) < 2 {
+			continue
+		}
+		candidates = append(candidates, candidate{words: phrase, score: score})
+	}
+	for term, w := range weight {
+		if !seen[term] {
+			candidates = append(candidates, candidate{words: []string{term}, score: w})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return strings.Join(candidates[i].words, " ") < strings.Join(candidates[j].words, " ")
+	})
+
+	tags := []string{}
+	used := map[string]bool{}
+	for _, c := range candidates {
+		if len(tags) == max {
+			break
+		}
+		// Skip candidates whose words are already covered by a higher-scoring tag.
+		covered := true
+		for _, w := range c.words {
+			if !used[w] {
+				covered = false
+			}
+		}
+		if covered {
+			continue
+		}
+		for _, w := range c.words {
+			used[w] = true
+		}
+		tags = append(tags, strings.Join(c.words, "-"))
+	}
+	return tags
+}
+
+// rakePhrases splits text into candidate key phrases at punctuation and stop words,
+// in the manner of the RAKE algorithm. Phrases longer than three words are dropped.
+func rakePhrases(text string) [][]string {
+	var phrases [][]string
+	for _, fragment := range phraseSeparator.Split(strings.ToLower(text), -1) {
+		var current []string
+		flush := func() {
+			if len(current) > 0 && len(current) <= 3 {
+				phrases = append(phrases, current)
+			}
+			current = nil
+		}
+		for _, word := range strings.FieldsFunc(fragment, isNotWordRune) {
+			if !isKeywordTerm(word) {
+				flush()
+				continue
+			}
+			current = append(current, word)
+		}
+		flush()
+	}
+	return phrases
+}
+
+// keywordTerms lowercases text and returns the words that can become keywords.
+func keywordTerms(text string) []string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), isNotWordRune) {
+		if isKeywordTerm(word) {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+func isNotWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+}
+
+// isKeywordTerm rejects stop words, very short words and pure numbers.
+func isKeywordTerm(word string) bool {
+	if len([]rune(word)) < 3 || stopWords[word] {
+		return false
+	}
+	for _, r := range word {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+var stopWords = func() map[string]bool {
+	words := strings.Fields(`
+		a about above after again against all also am an and any are aren't as at
+		be because been before being below between both but by can cannot could
+		did do does doing done down during each even ever every few for from further
+		get gets got had has have having he her here hers herself him himself his how
+		however i if in into is it its itself just like made make makes many may me
+		might more most much must my myself never no nor not now of off often on once
+		one only or other others our ours ourselves out over own per rather really
+		said same say says see seem seems shall she should since so some still such
+		than that the their theirs them themselves then there these they thing things
+		this those though through thus to too under until up upon us use used uses
+		using very via was way ways we well were what when where whether which while
+		who whom whose why will with within without would yet you your yours yourself
+		yourselves`)
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}()
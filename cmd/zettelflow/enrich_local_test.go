@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDeriveTitle(t *testing.T) {
+	tests := []struct {
+		name, body, want string
+	}{
+		{"heading", "Intro.\n\n## The *Real* Title\n\nText.", "The Real Title"},
+		{"sentence", "First idea here. Second idea.", "First idea here"},
+		{"bare hashes before a fence", "###\n```\ncode\n```\nFirst idea here.", "First idea here"},
+		{"heading in code", "```\n# not a title\n```\n\nFirst idea here.", "First idea here"},
+		{"empty heading", "# **\n\n## Second\n", "Second"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deriveTitle(tt.body); got != tt.want {
+				t.Errorf("deriveTitle(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateWords(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"one two three", 9, "one two…"},
+		{"ééééé", 5, "éé…"},
+		{"漢字漢字", 7, "漢字…"},
+	}
+	for _, tt := range tests {
+		got := truncateWords(tt.s, tt.max)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("truncateWords(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestLocalEnrichKeepsTitle(t *testing.T) {
+	corpus := &keywordCorpus{df: map[string]int{}}
+	tests := []struct {
+		name, note, want string
+	}{
+		{"kept", "---\ntitle: Title One\ntags:\n---\nFirst idea here. More.", "title: Title One"},
+		{"filled", "---\ntitle: \"\"\ntags:\n---\nFirst idea here. More.", "title: First idea here"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := localEnrich(tt.note, corpus, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("localEnrich() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractKeywordsIgnoresLinks(t *testing.T) {
+	dir := t.TempDir()
+	nav := "← [[20240101-idea-1|1a]] · ↑ [[structure-reading|1]] · [[20240101-idea-3|1a1]] →"
+	notes := []string{
+		"Gardening needs patience and compost.\n\n" + nav,
+		"Compost turns kitchen waste into soil.\n\n" + nav,
+	}
+	for i, note := range notes {
+		writeTestFile(t, filepath.Join(dir, fmt.Sprintf("note-%d.md", i)), "---\ntitle: x\n---\n"+note)
+	}
+	corpus := newKeywordCorpus(".md", dir)
+	for term := range corpus.df {
+		if strings.Contains(term, "1a") || strings.Contains(term, "idea") || strings.Contains(term, "structure") {
+			t.Errorf("corpus counts the link term %q", term)
+		}
+	}
+
+	tags := extractKeywords(notes[0], corpus, 10)
+	for _, tag := range tags {
+		if strings.Contains(tag, "1a") || strings.Contains(tag, "idea") || strings.Contains(tag, "structure") || strings.Contains(tag, "2024") {
+			t.Errorf("extractKeywords() = %q, has the link tag %q", tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		t.Error("extractKeywords() found no tags in the note text")
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// sourceLocation records where in the original source a piece of text came from,
+// e.g. {Unit: "page", Start: "3", End: "5"}.
+type sourceLocation struct {
+	Unit  string
+	Start string
+	End   string
+}
+
+// String renders the location as "page 3" or "page 3-5".
+func (l sourceLocation) String() string {
+	if l.End == "" || l.End == l.Start {
+		return fmt.Sprintf("%s %s", l.Unit, l.Start)
+	}
+	return fmt.Sprintf("%s %s-%s", l.Unit, l.Start, l.End)
+}
+
+// through returns a location spanning from the start of l to the end of last.
+func (l sourceLocation) through(last sourceLocation) sourceLocation {
+	if l.Unit == "" || l.Unit != last.Unit {
+		return l
+	}
+	end := last.End
+	if end == "" {
+		end = last.Start
+	}
+	return sourceLocation{Unit: l.Unit, Start: l.Start, End: end}
+}
+
+// locationMarker is the HTML comment written into ingest output in front of the text
+// that came from a location. It is invisible when the Markdown is rendered.
+func locationMarker(l sourceLocation) string {
+	return fmt.Sprintf("<!-- zettelflow:location %s -->", l)
+}
+
+var locationMarkerPattern = regexp.MustCompile(`<!-- zettelflow:location (.+?) -->`)
+
+// sourceSegment is a piece of extracted text together with its location in the source.
+// Segments without a location (plain text, stdin) have a zero Location.
+type sourceSegment struct {
+	Location sourceLocation
+	Text     string
+}
+
+// sourceDocument is the unit of work for the ingest stage. An extractor turns one input
+// file into one or more documents, each of which is sent through the ingest prompt.
+type sourceDocument struct {
+	Title string
+	// Meta holds descriptive metadata found in the source itself (e.g. "url", "author",
+	// "published"). It is written to the ingest output as source_* frontmatter fields.
+	Meta     map[string]string
+	Segments []sourceSegment
+}
+
+// plainDocument wraps already readable text in a document with a single segment.
+func plainDocument(text string) sourceDocument {
+	return sourceDocument{Segments: []sourceSegment{{Text: text}}}
+}
+
+// joinSegments concatenates the text of segments as paragraphs.
+func joinSegments(segments []sourceSegment) string {
+	parts := make([]string, 0, len(segments))
+	for _, s := range segments {
+		parts = append(parts, s.Text)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// segmentsLocation returns the location spanned by a run of segments.
+func segmentsLocation(segments []sourceSegment) sourceLocation {
+	if len(segments) == 0 {
+		return sourceLocation{}
+	}
+	return segments[0].Location.through(segments[len(segments)-1].Location)
+}
+
+// sourceExtractor converts the raw bytes of a supported file format into documents.
+type sourceExtractor struct {
+	name    string
+	detect  func(path string, data []byte) bool
+	extract func(path string, data []byte) ([]sourceDocument, error)
+}
+
+// sourceExtractors is consulted in order; the first extractor whose detect func
+// matches wins. Files no extractor recognises are ingested as plain text.
+var sourceExtractors = []sourceExtractor{
+	{name: "pdf", detect: isPDF, extract: extractPDF},
+	{name: "epub", detect: isEPUB, extract: extractEPUB},
+	{name: "docx", detect: isDOCX, extract: extractDOCX},
+	{name: "kindle", detect: isKindle, extract: extractKindle},
+	{name: "subtitles", detect: isSubtitle, extract: extractSubtitles},
+	{name: "chats", detect: isChatExport, extract: extractChats},
+	{name: "opml", detect: isOPML, extract: extractOPML},
+	{name: "feed", detect: isFeed, extract: extractFeed},
+	{name: "mbox", detect: isMbox, extract: extractMbox},
+	{name: "email", detect: isEmail, extract: extractEmail},
+	{name: "html", detect: isHTML, extract: extractHTML},
+	{name: "transcript", detect: isTranscript, extract: extractTranscript},
+}
+
+// extractorNames lists the formats that can be forced with ingest --format.
+func extractorNames() []string {
+	names := []string{"auto", "text"}
+	for _, e := range sourceExtractors {
+		names = append(names, e.name)
+	}
+	return names
+}
+
+// extractDocuments picks the extractor for a file and returns its documents. An empty
+// or "auto" format detects the extractor; any other format names the extractor to use.
+// A file the extractor cannot read gives a sourceError.
+func extractDocuments(path string, data []byte, format string) ([]sourceDocument, error) {
+	if format == "text" {
+		return []sourceDocument{plainDocument(decodeText(data))}, nil
+	}
+	forced := format != "" && format != "auto"
+	for _, e := range sourceExtractors {
+		if (forced && e.name == format) || (!forced && e.detect(path, data)) {
+			docs, err := e.extract(path, data)
+			if err != nil {
+				return nil, sourceError{fmt.Errorf("extracting %s as %s: %w", path, e.name, err)}
+			}
+			return docs, nil
+		}
+	}
+	if forced {
+		return nil, fmt.Errorf("unknown format %q (expected one of %s)", format, strings.Join(extractorNames(), ", "))
+	}
+	return []sourceDocument{plainDocument(decodeText(data))}, nil
+}
+
+// chunkSegments groups consecutive segments so that each group stays under maxChars.
+// A single segment larger than maxChars is broken at paragraph boundaries and keeps
+// its location in every piece.
+func chunkSegments(segments []sourceSegment, maxChars int) [][]sourceSegment {
+	if maxChars <= 0 {
+		return [][]sourceSegment{segments}
+	}
+
+	var pieces []sourceSegment
+	for _, s := range segments {
+		if len(s.Text) <= maxChars {
+			pieces = append(pieces, s)
+			continue
+		}
+		for _, part := range splitParagraphs(s.Text, maxChars) {
+			pieces = append(pieces, sourceSegment{Location: s.Location, Text: part})
+		}
+	}
+
+	var chunks [][]sourceSegment
+	var current []sourceSegment
+	size := 0
+	for _, p := range pieces {
+		if len(current) > 0 && size+len(p.Text) > maxChars {
+			chunks = append(chunks, current)
+			current, size = nil, 0
+		}
+		current = append(current, p)
+		size += len(p.Text) + 2
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// splitParagraphs breaks text into pieces of at most maxChars, preferring blank lines,
+// then line breaks, then spaces as cut points.
+func splitParagraphs(text string, maxChars int) []string {
+	var parts []string
+	for len(text) > maxChars {
+		window := text[:maxChars]
+		cut := strings.LastIndex(window, "\n\n")
+		if cut <= 0 {
+			cut = strings.LastIndex(window, "\n")
+		}
+		if cut <= 0 {
+			cut = strings.LastIndex(window, " ")
+		}
+		if cut <= 0 {
+			cut = maxChars
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		parts = append(parts, strings.TrimSpace(text[:cut]))
+		text = strings.TrimSpace(text[cut:])
+	}
+	if text != "" {
+		parts = append(parts, text)
+	}
+	return parts
+}
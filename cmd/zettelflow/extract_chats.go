@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isChatExport detects the conversations.json of a ChatGPT or Claude data export.
+func isChatExport(file string, data []byte) bool {
+	head := bytes.TrimLeft(data[:min(len(data), 64<<10)], " \t\r\n\xef\xbb\xbf")
+	if !bytes.HasPrefix(head, []byte("[")) {
+		return false
+	}
+	return bytes.Contains(head, []byte(`"mapping"`)) || bytes.Contains(head, []byte(`"chat_messages"`))
+}
+
+// chatTurn is one message of a conversation.
+type chatTurn struct {
+	Role string
+	Text string
+}
+
+// extractChats turns every conversation of a ChatGPT or Claude export into a document
+// with role-labelled turns. The conversation's creation date is kept as metadata so
+// that ingest --since/--until can select conversations.
+func extractChats(file string, data []byte) ([]sourceDocument, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	var docs []sourceDocument
+	for _, item := range raw {
+		var probe struct {
+			Mapping      json.RawMessage `json:"mapping"`
+			ChatMessages json.RawMessage `json:"chat_messages"`
+		}
+		if err := json.Unmarshal(item, &probe); err != nil {
+			return nil, err
+		}
+		var doc sourceDocument
+		var err error
+		switch {
+		case probe.Mapping != nil:
+			doc, err = chatGPTConversation(item)
+		case probe.ChatMessages != nil:
+			doc, err = claudeConversation(item)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Segments) > 0 {
+			docs = append(docs, doc)
+		}
+	}
+	if len(docs) == 0 {
+		return nil, errors.New("no conversations found")
+	}
+	return docs, nil
+}
+
+// chatGPTConversation follows a ChatGPT conversation from its current node back to the
+// root, which yields the branch the user last saw when messages were edited or regenerated.
+func chatGPTConversation(item json.RawMessage) (sourceDocument, error) {
+	var conv struct {
+		ID          string  `json:"id"`
+		Title       string  `json:"title"`
+		CreateTime  float64 `json:"create_time"`
+		UpdateTime  float64 `json:"update_time"`
+		CurrentNode string  `json:"current_node"`
+		Mapping     map[string]struct {
+			Parent  string `json:"parent"`
+			Message *struct {
+				Author struct {
+					Role string `json:"role"`
+				} `json:"author"`
+				Content struct {
+					ContentType string            `json:"content_type"`
+					Parts       []json.RawMessage `json:"parts"`
+					Text        string            `json:"text"`
+				} `json:"content"`
+				Metadata struct {
+					Hidden bool `json:"is_visually_hidden_from_conversation"`
+				} `json:"metadata"`
+			} `json:"message"`
+		} `json:"mapping"`
+	}
+	if err := json.Unmarshal(item, &conv); err != nil {
+		return sourceDocument{}, err
+	}
+
+	var turns []chatTurn
+	seen := map[string]bool{}
+	for id := conv.CurrentNode; id != "" && !seen[id]; id = conv.Mapping[id].Parent {
+		seen[id] = true
+		msg := conv.Mapping[id].Message
+		if msg == nil || msg.Metadata.Hidden {
+			continue
+		}
+		role := msg.Author.Role
+		if role != "user" && role != "assistant" {
+			continue // system prompts and tool calls
+		}
+		var parts []string
+		for _, p := range msg.Content.Parts {
+			var s string
+			if json.Unmarshal(p, &s) == nil && strings.TrimSpace(s) != "" {
+				parts = append(parts, s)
+			}
+		}
+		if msg.Content.ContentType == "code" && msg.Content.Text != "" {
+			parts = append(parts, "```\n"+msg.Content.Text+"\n```")
+		}
+		if text := strings.TrimSpace(strings.Join(parts, "\n\n")); text != "" {
+			turns = append(turns, chatTurn{Role: role, Text: text})
+		}
+	}
+	for i, j := 0, len(turns)-1; i < j; i, j = i+1, j-1 {
+		turns[i], turns[j] = turns[j], turns[i]
+	}
+
+	meta := map[string]string{"platform": "chatgpt", "conversation": conv.ID}
+	if conv.CreateTime > 0 {
+		meta["created"] = unixSeconds(conv.CreateTime).Format(time.RFC3339)
+	}
+	if conv.UpdateTime > 0 {
+		meta["updated"] = unixSeconds(conv.UpdateTime).Format(time.RFC3339)
+	}
+	return chatDocument(conv.Title, meta, turns), nil
+}
+
+// claudeConversation reads a conversation of a Claude export, whose messages are
+// already stored in order.
+func claudeConversation(item json.RawMessage) (sourceDocument, error) {
+	var conv struct {
+		UUID      string `json:"uuid"`
+		Name      string `json:"name"`
+		CreatedAt string `json:"created_at"`
+		UpdatedAt string `json:"updated_at"`
+		Messages  []struct {
+			Sender  string `json:"sender"`
+			Text    string `json:"text"`
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"chat_messages"`
+	}
+	if err := json.Unmarshal(item, &conv); err != nil {
+		return sourceDocument{}, err
+	}
+
+	var turns []chatTurn
+	for _, m := range conv.Messages {
+		var parts []string
+		for _, c := range m.Content {
+			if c.Type == "text" && strings.TrimSpace(c.Text) != "" {
+				parts = append(parts, c.Text)
+			}
+		}
+		text := strings.TrimSpace(strings.Join(parts, "\n\n"))
+		if text == "" {
+			text = strings.TrimSpace(m.Text)
+		}
+		if text == "" {
+			continue
+		}
+		role := "assistant"
+		if m.Sender == "human" {
+			role = "user"
+		}
+		turns = append(turns, chatTurn{Role: role, Text: text})
+	}
+
+	meta := map[string]string{"platform": "claude", "conversation": conv.UUID}
+	for key, value := range map[string]string{"created": conv.CreatedAt, "updated": conv.UpdatedAt} {
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			meta[key] = t.UTC().Format(time.RFC3339)
+		}
+	}
+	return chatDocument(conv.Name, meta, turns), nil
+}
+
+// chatDocument lays out the turns of a conversation under its title, one segment per
+// turn so that notes can point back to the turns they came from.
+func chatDocument(title string, meta map[string]string, turns []chatTurn) sourceDocument {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = "Untitled conversation"
+	}
+	doc := sourceDocument{Title: title, Meta: map[string]string{}}
+	for key, value := range meta {
+		if value != "" {
+			doc.Meta[key] = value
+		}
+	}
+	for i, t := range turns {
+		label := "User"
+		if t.Role == "assistant" {
+			label = "Assistant"
+		}
+		text := "**" + label + ":** " + t.Text
+		if i == 0 {
+			text = "# " + title + "\n\n" + text
+		}
+		doc.Segments = append(doc.Segments, sourceSegment{
+			Location: sourceLocation{Unit: "turn", Start: strconv.Itoa(i + 1)},
+			Text:     text,
+		})
+	}
+	return doc
+}
+
+// unixSeconds converts the fractional Unix timestamps of ChatGPT exports.
+func unixSeconds(ts float64) time.Time {
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const chatGPTExport = `[{
+  "id": "c1", "title": "Zettelkasten basics", "create_time": 1700000000.5, "update_time": 1700003600,
+  "current_node": "n4",
+  "mapping": {
+    "root": {"parent": "", "message": null},
+    "n1": {"parent": "root", "message": {"author": {"role": "system"}, "content": {"content_type": "text", "parts": ["You are helpful."]}, "metadata": {"is_visually_hidden_from_conversation": true}}},
+    "n2": {"parent": "n1", "message": {"author": {"role": "user"}, "content": {"content_type": "text", "parts": ["What is a Zettel?"]}, "metadata": {}}},
+    "old": {"parent": "n2", "message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["A discarded answer."]}, "metadata": {}}},
+    "n3": {"parent": "n2", "message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["A single note."]}, "metadata": {}}},
+    "n4": {"parent": "n3", "message": {"author": {"role": "tool"}, "content": {"content_type": "text", "parts": ["tool output"]}, "metadata": {}}}
+  }
+}]`
+
+const claudeExport = `[{
+  "uuid": "u1", "name": "", "created_at": "2024-05-01T10:00:00.123456+02:00", "updated_at": "2024-05-01T11:00:00Z",
+  "chat_messages": [
+    {"sender": "human", "text": "Hello", "content": [{"type": "text", "text": "Hello"}]},
+    {"sender": "assistant", "text": "", "content": [{"type": "tool_use", "text": ""}, {"type": "text", "text": "Hi there."}]},
+    {"sender": "human", "text": "   ", "content": []}
+  ]
+}, {
+  "uuid": "u2", "name": "Empty", "chat_messages": []
+}]`
+
+func TestIsChatExport(t *testing.T) {
+	tests := []struct {
+		name, data string
+		want       bool
+	}{
+		{"chatgpt", chatGPTExport, true},
+		{"claude", "\xef\xbb\xbf\n" + claudeExport, true},
+		{"other json", `[{"id": 1}]`, false},
+		{"object", `{"mapping": {}}`, false},
+	}
+	for _, tt := range tests {
+		if got := isChatExport("conversations.json", []byte(tt.data)); got != tt.want {
+			t.Errorf("isChatExport(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtractChats(t *testing.T) {
+	tests := []struct {
+		name, data string
+		want       []sourceDocument
+	}{
+		{"chatgpt", chatGPTExport, []sourceDocument{{
+			Title: "Zettelkasten basics",
+			Meta:  map[string]string{"platform": "chatgpt", "conversation": "c1", "created": "2023-11-14T22:13:20Z", "updated": "2023-11-14T23:13:20Z"},
+			Segments: []sourceSegment{
+				{Location: sourceLocation{Unit: "turn", Start: "1"}, Text: "# Zettelkasten basics\n\n**User:** What is a Zettel?"},
+				{Location: sourceLocation{Unit: "turn", Start: "2"}, Text: "**Assistant:** A single note."},
+			},
+		}}},
+		{"claude", claudeExport, []sourceDocument{{
+			Title: "Untitled conversation",
+			Meta:  map[string]string{"platform": "claude", "conversation": "u1", "created": "2024-05-01T08:00:00Z", "updated": "2024-05-01T11:00:00Z"},
+			Segments: []sourceSegment{
+				{Location: sourceLocation{Unit: "turn", Start: "1"}, Text: "# Untitled conversation\n\n**User:** Hello"},
+				{Location: sourceLocation{Unit: "turn", Start: "2"}, Text: "**Assistant:** Hi there."},
+			},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractChats("conversations.json", []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractChats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := extractChats("conversations.json", []byte(`[]`)); err == nil {
+		t.Error("extractChats() without conversations succeeded")
+	}
+}
+
+func TestSelectDocuments(t *testing.T) {
+	docs := []sourceDocument{
+		{Title: "Planning the garden", Meta: map[string]string{"created": "2024-03-10T12:00:00Z"}},
+		{Title: "Weekly review", Meta: map[string]string{"created": "2024-04-02T12:00:00Z", "from": "Ann <ann@example.com>"}},
+		{Title: "Undated notes"},
+	}
+	tests := []struct {
+		name  string
+		flags map[string]string
+		want  []string
+	}{
+		{"none", nil, []string{"Planning the garden", "Weekly review", "Undated notes"}},
+		{"since", map[string]string{"since": "2024-04-01"}, []string{"Weekly review", "Undated notes"}},
+		{"until", map[string]string{"until": "2024-03-20"}, []string{"Planning the garden", "Undated notes"}},
+		{"title", map[string]string{"title": "^weekly"}, []string{"Weekly review"}},
+		{"from", map[string]string{"from": "ann@"}, []string{"Weekly review"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, ingestCmd, tt.flags)
+			selected, err := selectDocuments(docs, ingestCmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, doc := range selected {
+				got = append(got, doc.Title)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectDocuments() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, flags := range []map[string]string{{"since": "April"}, {"title": "("}} {
+		t.Run("invalid", func(t *testing.T) {
+			setFlags(t, ingestCmd, flags)
+			if _, err := selectDocuments(docs, ingestCmd); err == nil {
+				t.Errorf("selectDocuments() with %v succeeded", flags)
+			}
+		})
+	}
+}
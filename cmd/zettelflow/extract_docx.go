@@ -0,0 +1,324 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// isDOCX detects Word documents by extension or by the main document part inside the zip.
+func isDOCX(file string, data []byte) bool {
+	if !isZip(data) {
+		return false
+	}
+	if strings.EqualFold(filepath.Ext(file), ".docx") {
+		return true
+	}
+	return bytes.Contains(data, []byte("word/document.xml"))
+}
+
+// docxStyles maps a paragraph style to its Markdown heading level (0 for body text).
+type docxStyles map[string]int
+
+// docxNumbering maps numId and indentation level to whether the list is ordered.
+type docxNumbering map[string]map[string]bool
+
+// extractDOCX converts a Word document to Markdown, keeping headings, lists, emphasis
+// and tables. Each top-level heading starts a new section, which becomes the location
+// carried into the ingest output.
+func extractDOCX(file string, data []byte) ([]sourceDocument, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := readZipFile(archive, "word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	styles := readDOCXStyles(archive)
+	numbering := readDOCXNumbering(archive)
+
+	doc := sourceDocument{Title: readDOCXTitle(archive)}
+	if doc.Title == "" {
+		doc.Title = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+
+	var (
+		blocks    []string
+		section   = 0
+		para      paragraphState
+		run       runState
+		inRunProp bool
+		inTable   int
+		table     [][]string
+		row       []string
+		cell      []string
+		counters  = map[string]int{}
+	)
+	flushSection := func() {
+		text := strings.TrimSpace(strings.Join(blocks, ""))
+		blocks = nil
+		if text == "" {
+			return
+		}
+		section++
+		doc.Segments = append(doc.Segments, sourceSegment{
+			Location: sourceLocation{Unit: "section", Start: strconv.Itoa(section)},
+			Text:     text,
+		})
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				para = paragraphState{}
+			case "pStyle":
+				para.style = docxAttr(t, "val")
+			case "ilvl":
+				para.level = docxAttr(t, "val")
+			case "numId":
+				para.numID = docxAttr(t, "val")
+			case "r":
+				run = runState{}
+			case "rPr":
+				inRunProp = true
+			case "b":
+				if inRunProp && docxOn(t) {
+					run.bold = true
+				}
+			case "i":
+				if inRunProp && docxOn(t) {
+					run.italic = true
+				}
+			case "t":
+				var text string
+				if err := decoder.DecodeElement(&text, &t); err != nil {
+					return nil, err
+				}
+				run.text.WriteString(text)
+			case "tab":
+				run.text.WriteString("\t")
+			case "br", "cr":
+				run.text.WriteString("\n")
+			case "tbl":
+				inTable++
+				table = nil
+			case "tr":
+				row = nil
+			case "tc":
+				cell = nil
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "rPr":
+				inRunProp = false
+			case "r":
+				text := run.text.String()
+				if run.bold {
+					text = wrapInline(text, "**")
+				}
+				if run.italic {
+					text = wrapInline(text, "*")
+				}
+				para.text.WriteString(text)
+			case "p":
+				text := strings.TrimSpace(para.text.String())
+				if inTable > 0 {
+					cell = append(cell, text)
+					continue
+				}
+				if text == "" {
+					continue
+				}
+				level := styles[para.style]
+				switch {
+				case level == 1:
+					flushSection()
+					blocks = append(blocks, "# "+text+"\n\n")
+				case level > 1:
+					blocks = append(blocks, closeList(blocks)+strings.Repeat("#", level)+" "+text+"\n\n")
+				case para.numID != "" && para.numID != "0":
+					depth, _ := strconv.Atoi(para.level)
+					bullet := "- "
+					if numbering[para.numID][para.level] {
+						key := para.numID + ":" + para.level
+						counters[key]++
+						bullet = strconv.Itoa(counters[key]) + ". "
+					}
+					// A list item ends any deeper numbering below it.
+					for d := depth + 1; d < 9; d++ {
+						delete(counters, para.numID+":"+strconv.Itoa(d))
+					}
+					blocks = append(blocks, strings.Repeat("   ", depth)+bullet+text+"\n")
+				default:
+					blocks = append(blocks, closeList(blocks)+text+"\n\n")
+				}
+			case "tc":
+				row = append(row, strings.ReplaceAll(strings.Join(cell, " "), "|", `\|`))
+				cell = nil
+			case "tr":
+				table = append(table, row)
+				row = nil
+			case "tbl":
+				inTable--
+				blocks = append(blocks, closeList(blocks)+markdownTable(table)+"\n\n")
+				table = nil
+			}
+		}
+	}
+	flushSection()
+	if len(doc.Segments) == 0 {
+		return nil, errors.New("document contains no text")
+	}
+	return []sourceDocument{doc}, nil
+}
+
+type paragraphState struct {
+	style string
+	level string
+	numID string
+	text  strings.Builder
+}
+
+type runState struct {
+	bold   bool
+	italic bool
+	text   strings.Builder
+}
+
+// closeList returns the separator needed to end a preceding list with a blank line.
+func closeList(blocks []string) string {
+	if len(blocks) > 0 && !strings.HasSuffix(blocks[len(blocks)-1], "\n\n") {
+		return "\n"
+	}
+	return ""
+}
+
+// markdownTable renders rows as a GitHub-flavoured table with the first row as header.
+func markdownTable(rows [][]string) string {
+	width := 0
+	for _, r := range rows {
+		width = max(width, len(r))
+	}
+	if width == 0 {
+		return ""
+	}
+	var lines []string
+	for i, r := range rows {
+		for len(r) < width {
+			r = append(r, "")
+		}
+		lines = append(lines, "| "+strings.Join(r, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", width))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// readDOCXStyles resolves style IDs to heading levels using the style names, which stay
+// "heading 1".."heading 9" even in localised documents whose IDs differ.
+func readDOCXStyles(archive *zip.Reader) docxStyles {
+	var parsed struct {
+		Styles []struct {
+			ID   string `xml:"styleId,attr"`
+			Name struct {
+				Val string `xml:"val,attr"`
+			} `xml:"name"`
+		} `xml:"style"`
+	}
+	styles := docxStyles{}
+	if err := readZipXML(archive, "word/styles.xml", &parsed); err != nil {
+		return styles
+	}
+	for _, s := range parsed.Styles {
+		name := strings.ToLower(s.Name.Val)
+		switch {
+		case name == "title":
+			styles[s.ID] = 1
+		case strings.HasPrefix(name, "heading "):
+			if level, err := strconv.Atoi(strings.TrimPrefix(name, "heading ")); err == nil {
+				styles[s.ID] = min(level, 6)
+			}
+		}
+	}
+	return styles
+}
+
+// readDOCXNumbering records which list levels are numbered rather than bulleted.
+func readDOCXNumbering(archive *zip.Reader) docxNumbering {
+	var parsed struct {
+		Abstract []struct {
+			ID     string `xml:"abstractNumId,attr"`
+			Levels []struct {
+				Level  string `xml:"ilvl,attr"`
+				Format struct {
+					Val string `xml:"val,attr"`
+				} `xml:"numFmt"`
+			} `xml:"lvl"`
+		} `xml:"abstractNum"`
+		Nums []struct {
+			ID       string `xml:"numId,attr"`
+			Abstract struct {
+				Val string `xml:"val,attr"`
+			} `xml:"abstractNumId"`
+		} `xml:"num"`
+	}
+	numbering := docxNumbering{}
+	if err := readZipXML(archive, "word/numbering.xml", &parsed); err != nil {
+		return numbering
+	}
+	ordered := map[string]map[string]bool{}
+	for _, a := range parsed.Abstract {
+		ordered[a.ID] = map[string]bool{}
+		for _, l := range a.Levels {
+			ordered[a.ID][l.Level] = l.Format.Val != "bullet" && l.Format.Val != "none" && l.Format.Val != ""
+		}
+	}
+	for _, n := range parsed.Nums {
+		numbering[n.ID] = ordered[n.Abstract.Val]
+	}
+	return numbering
+}
+
+// readDOCXTitle reads the document title from the core properties, if set.
+func readDOCXTitle(archive *zip.Reader) string {
+	var core struct {
+		Title string `xml:"title"`
+	}
+	if err := readZipXML(archive, "docProps/core.xml", &core); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(core.Title)
+}
+
+func docxAttr(e xml.StartElement, local string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// docxOn reports whether a toggle property such as <w:b/> is switched on.
+func docxOn(e xml.StartElement) bool {
+	v := docxAttr(e, "val")
+	return v != "0" && v != "false" && v != "off"
+}
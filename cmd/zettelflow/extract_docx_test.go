@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const docxNS = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+
+// docxParagraph renders a paragraph with the given properties and runs.
+func docxParagraph(props string, runs ...string) string {
+	return "<w:p><w:pPr>" + props + "</w:pPr>" + strings.Join(runs, "") + "</w:p>"
+}
+
+func docxRun(props, text string) string {
+	return `<w:r><w:rPr>` + props + `</w:rPr><w:t xml:space="preserve">` + text + `</w:t></w:r>`
+}
+
+func testDOCX(t *testing.T, title string, body ...string) []byte {
+	files := []string{
+		"[Content_Types].xml", `<Types/>`,
+		"word/document.xml", `<w:document ` + docxNS + `><w:body>` + strings.Join(body, "") + `</w:body></w:document>`,
+		"word/styles.xml", `<w:styles ` + docxNS + `>
+<w:style w:styleId="Titel"><w:name w:val="Title"/></w:style>
+<w:style w:styleId="berschrift1"><w:name w:val="heading 1"/></w:style>
+<w:style w:styleId="berschrift2"><w:name w:val="heading 2"/></w:style>
+</w:styles>`,
+		"word/numbering.xml", `<w:numbering ` + docxNS + `>
+<w:abstractNum w:abstractNumId="0"><w:lvl w:ilvl="0"><w:numFmt w:val="decimal"/></w:lvl></w:abstractNum>
+<w:abstractNum w:abstractNumId="1"><w:lvl w:ilvl="0"><w:numFmt w:val="bullet"/></w:lvl></w:abstractNum>
+<w:num w:numId="1"><w:abstractNumId w:val="0"/></w:num>
+<w:num w:numId="2"><w:abstractNumId w:val="1"/></w:num>
+</w:numbering>`,
+	}
+	if title != "" {
+		files = append(files, "docProps/core.xml", `<cp:coreProperties xmlns:cp="cp" xmlns:dc="dc"><dc:title>`+title+`</dc:title></cp:coreProperties>`)
+	}
+	return testZip(t, files...)
+}
+
+func TestIsDOCX(t *testing.T) {
+	docx := testDOCX(t, "")
+	tests := []struct {
+		file string
+		data []byte
+		want bool
+	}{
+		{"report.docx", docx, true},
+		{"attachment", docx, true},
+		{"archive.zip", testZip(t, "readme.txt", "hello"), false},
+		{"report.docx", []byte("not a zip"), false},
+	}
+	for _, tt := range tests {
+		if got := isDOCX(tt.file, tt.data); got != tt.want {
+			t.Errorf("isDOCX(%q) = %v, want %v", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestExtractDOCX(t *testing.T) {
+	data := testDOCX(t, "Quarterly Notes",
+		docxParagraph(`<w:pStyle w:val="Titel"/>`, docxRun("", "Introduction")),
+		docxParagraph("", docxRun("", "Plain and "), docxRun("<w:b/>", "bold"), docxRun("", " and "), docxRun(`<w:i w:val="1"/>`, "italic"), docxRun(`<w:b w:val="0"/>`, " text.")),
+		docxParagraph(`<w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr>`, docxRun("", "first")),
+		docxParagraph(`<w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr>`, docxRun("", "second")),
+		docxParagraph(`<w:numPr><w:ilvl w:val="0"/><w:numId w:val="2"/></w:numPr>`, docxRun("", "bullet")),
+		docxParagraph(`<w:pStyle w:val="berschrift2"/>`, docxRun("", "Details")),
+		`<w:tbl><w:tr><w:tc>`+docxParagraph("", docxRun("", "Key"))+`</w:tc><w:tc>`+docxParagraph("", docxRun("", "Value"))+`</w:tc></w:tr>`+
+			`<w:tr><w:tc>`+docxParagraph("", docxRun("", "a|b"))+`</w:tc><w:tc>`+docxParagraph("", docxRun("", "1"))+`</w:tc></w:tr></w:tbl>`,
+		docxParagraph(`<w:pStyle w:val="berschrift1"/>`, docxRun("", "Second Section")),
+		docxParagraph("", docxRun("", "More text.")),
+	)
+	docs, err := extractDOCX("notes.docx", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 || docs[0].Title != "Quarterly Notes" {
+		t.Fatalf("extractDOCX() = %+v, want one document with the core title", docs)
+	}
+	want := []sourceSegment{
+		{Location: sourceLocation{Unit: "section", Start: "1"}, Text: "# Introduction\n\n" +
+			"Plain and **bold** and *italic* text.\n\n" +
+			"1. first\n2. second\n- bullet\n\n" +
+			"## Details\n\n" +
+			"| Key | Value |\n| --- | --- |\n| a\\|b | 1 |"},
+		{Location: sourceLocation{Unit: "section", Start: "2"}, Text: "# Second Section\n\nMore text."},
+	}
+	if !reflect.DeepEqual(docs[0].Segments, want) {
+		t.Errorf("Segments = %q, want %q", docs[0].Segments, want)
+	}
+}
+
+func TestExtractDOCXTitle(t *testing.T) {
+	docs, err := extractDOCX("dir/minutes.docx", testDOCX(t, "", docxParagraph("", docxRun("", "Text."))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if docs[0].Title != "minutes" {
+		t.Errorf("Title = %q, want the file name", docs[0].Title)
+	}
+	if _, err := extractDOCX("empty.docx", testDOCX(t, "")); err == nil {
+		t.Error("extractDOCX() of a document without text succeeded")
+	}
+}
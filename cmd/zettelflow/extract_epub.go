@@ -0,0 +1,219 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// isEPUB detects EPUBs by extension or by the mimetype entry that the EPUB container
+// format requires to be stored first in the zip archive.
+func isEPUB(file string, data []byte) bool {
+	if !isZip(data) {
+		return false
+	}
+	return strings.EqualFold(filepath.Ext(file), ".epub") ||
+		bytes.Contains(data[:min(len(data), 128)], []byte("application/epub+zip"))
+}
+
+func isZip(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubPackage struct {
+	Title    string `xml:"metadata>title"`
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine struct {
+		Toc      string `xml:"toc,attr"`
+		Itemrefs []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+type ncxNavPoint struct {
+	Label   string        `xml:"navLabel>text"`
+	Content ncxContent    `xml:"content"`
+	Points  []ncxNavPoint `xml:"navPoint"`
+}
+
+type ncxContent struct {
+	Src string `xml:"src,attr"`
+}
+
+// extractEPUB converts each spine document to Markdown, in reading order. Chapter titles
+// from the table of contents are kept as headings, and each chapter becomes a segment so
+// that chapter numbers are carried into the ingest output as locations.
+func extractEPUB(file string, data []byte) ([]sourceDocument, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var container epubContainer
+	if err := readZipXML(archive, "META-INF/container.xml", &container); err != nil {
+		return nil, err
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, errors.New("container.xml lists no package document")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+	var pkg epubPackage
+	if err := readZipXML(archive, opfPath, &pkg); err != nil {
+		return nil, err
+	}
+	base := path.Dir(opfPath)
+
+	hrefs := map[string]string{}
+	var navHref string
+	for _, item := range pkg.Manifest {
+		href := path.Join(base, unescapeHref(item.Href))
+		hrefs[item.ID] = href
+		if strings.Contains(item.Properties, "nav") {
+			navHref = href
+		}
+	}
+	titles := epubChapterTitles(archive, navHref, hrefs[pkg.Spine.Toc])
+
+	doc := sourceDocument{Title: strings.TrimSpace(pkg.Title)}
+	if doc.Title == "" {
+		doc.Title = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	chapter := 0
+	for _, ref := range pkg.Spine.Itemrefs {
+		href, ok := hrefs[ref.IDRef]
+		if !ok || href == navHref {
+			continue
+		}
+		raw, err := readZipFile(archive, href)
+		if err != nil {
+			return nil, err
+		}
+		root, err := html.Parse(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", href, err)
+		}
+		body := findElement(root, atom.Body)
+		if body == nil {
+			body = root
+		}
+		text := htmlToMarkdown(body)
+		if text == "" {
+			continue
+		}
+		if title := titles[href]; title != "" && !strings.HasPrefix(text, "#") {
+			text = "# " + title + "\n\n" + text
+		}
+		chapter++
+		doc.Segments = append(doc.Segments, sourceSegment{
+			Location: sourceLocation{Unit: "chapter", Start: strconv.Itoa(chapter)},
+			Text:     text,
+		})
+	}
+	if len(doc.Segments) == 0 {
+		return nil, errors.New("no readable chapters in spine")
+	}
+	return []sourceDocument{doc}, nil
+}
+
+// epubChapterTitles maps content documents to their titles, read from the EPUB 3
+// navigation document or, failing that, the EPUB 2 NCX.
+func epubChapterTitles(archive *zip.Reader, navHref, ncxHref string) map[string]string {
+	titles := map[string]string{}
+	if navHref != "" {
+		if raw, err := readZipFile(archive, navHref); err == nil {
+			if root, err := html.Parse(bytes.NewReader(raw)); err == nil {
+				var walk func(*html.Node)
+				walk = func(n *html.Node) {
+					if n.Type == html.ElementNode && n.DataAtom == atom.A {
+						target := resolveEPUBHref(navHref, attr(n, "href"))
+						if _, seen := titles[target]; !seen {
+							titles[target] = strings.TrimSpace(inlineWhitespace.ReplaceAllString(textContent(n), " "))
+						}
+					}
+					for c := n.FirstChild; c != nil; c = c.NextSibling {
+						walk(c)
+					}
+				}
+				walk(root)
+			}
+		}
+	}
+	if len(titles) == 0 && ncxHref != "" {
+		var ncx struct {
+			Points []ncxNavPoint `xml:"navMap>navPoint"`
+		}
+		if err := readZipXML(archive, ncxHref, &ncx); err == nil {
+			var walk func([]ncxNavPoint)
+			walk = func(points []ncxNavPoint) {
+				for _, p := range points {
+					target := resolveEPUBHref(ncxHref, p.Content.Src)
+					if _, seen := titles[target]; !seen {
+						titles[target] = strings.TrimSpace(p.Label)
+					}
+					walk(p.Points)
+				}
+			}
+			walk(ncx.Points)
+		}
+	}
+	return titles
+}
+
+// resolveEPUBHref resolves a link relative to the document containing it, dropping any fragment.
+func resolveEPUBHref(from, href string) string {
+	if i := strings.Index(href, "#"); i != -1 {
+		href = href[:i]
+	}
+	return path.Join(path.Dir(from), unescapeHref(href))
+}
+
+// unescapeHref decodes percent-escapes, since hrefs are URLs but zip entries are plain names.
+func unescapeHref(href string) string {
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		return unescaped
+	}
+	return href
+}
+
+func readZipFile(archive *zip.Reader, name string) ([]byte, error) {
+	f, err := archive.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func readZipXML(archive *zip.Reader, name string, v interface{}) error {
+	raw, err := readZipFile(archive, name)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
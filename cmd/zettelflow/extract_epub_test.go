@@ -0,0 +1,95 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// testZip builds a zip archive of name and content pairs, stored in the order given.
+func testZip(t *testing.T, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(files); i += 2 {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: files[i], Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(files[i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testEPUB(t *testing.T) []byte {
+	return testZip(t,
+		"mimetype", "application/epub+zip",
+		"META-INF/container.xml", `<?xml version="1.0"?>
+<container><rootfiles><rootfile full-path="OEBPS/content.opf"/></rootfiles></container>`,
+		"OEBPS/content.opf", `<?xml version="1.0"?>
+<package><metadata><title>How to Take Notes</title></metadata>
+<manifest>
+  <item id="nav" href="nav.xhtml" properties="nav" media-type="application/xhtml+xml"/>
+  <item id="c1" href="text/chapter%201.xhtml" media-type="application/xhtml+xml"/>
+  <item id="c2" href="text/chapter2.xhtml" media-type="application/xhtml+xml"/>
+  <item id="empty" href="text/empty.xhtml" media-type="application/xhtml+xml"/>
+</manifest>
+<spine><itemref idref="nav"/><itemref idref="c1"/><itemref idref="empty"/><itemref idref="c2"/></spine>
+</package>`,
+		"OEBPS/nav.xhtml", `<html><body><nav><ol>
+<li><a href="text/chapter%201.xhtml#start">The Slip Box</a></li>
+<li><a href="text/chapter2.xhtml">Writing</a></li>
+</ol></nav></body></html>`,
+		"OEBPS/text/chapter 1.xhtml", `<html><body><p>Every note goes into the <em>slip box</em>.</p></body></html>`,
+		"OEBPS/text/empty.xhtml", `<html><body></body></html>`,
+		"OEBPS/text/chapter2.xhtml", `<html><body><h2>On Writing</h2><p>Write in your own words.</p></body></html>`,
+	)
+}
+
+func TestIsEPUB(t *testing.T) {
+	epub := testEPUB(t)
+	other := testZip(t, "readme.txt", "hello")
+	tests := []struct {
+		file string
+		data []byte
+		want bool
+	}{
+		{"book.epub", epub, true},
+		{"download", epub, true},
+		{"BOOK.EPUB", other, true},
+		{"archive.zip", other, false},
+		{"book.epub", []byte("not a zip"), false},
+	}
+	for _, tt := range tests {
+		if got := isEPUB(tt.file, tt.data); got != tt.want {
+			t.Errorf("isEPUB(%q) = %v, want %v", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestExtractEPUB(t *testing.T) {
+	docs, err := extractEPUB("book.epub", testEPUB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 || docs[0].Title != "How to Take Notes" {
+		t.Fatalf("extractEPUB() = %+v, want one document with the package title", docs)
+	}
+	want := []sourceSegment{
+		{Location: sourceLocation{Unit: "chapter", Start: "1"}, Text: "# The Slip Box\n\nEvery note goes into the *slip box*."},
+		{Location: sourceLocation{Unit: "chapter", Start: "2"}, Text: "## On Writing\n\nWrite in your own words."},
+	}
+	if !reflect.DeepEqual(docs[0].Segments, want) {
+		t.Errorf("Segments = %q, want %q", docs[0].Segments, want)
+	}
+
+	if _, err := extractEPUB("broken.epub", testZip(t, "mimetype", "application/epub+zip")); err == nil {
+		t.Error("extractEPUB() without a container succeeded")
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// isOPML detects OPML outlines by extension or by their root element.
+func isOPML(file string, data []byte) bool {
+	if strings.EqualFold(filepath.Ext(file), ".opml") {
+		return true
+	}
+	return bytes.Contains(data[:min(len(data), 1024)], []byte("<opml"))
+}
+
+// isFeed detects RSS 2.0, RSS 1.0 (RDF) and Atom files by extension or by their root element.
+func isFeed(file string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".rss", ".atom":
+		return true
+	}
+	head := data[:min(len(data), 1024)]
+	return bytes.Contains(head, []byte("<rss")) ||
+		bytes.Contains(head, []byte("<feed")) && bytes.Contains(head, []byte("http://www.w3.org/2005/Atom")) ||
+		bytes.Contains(head, []byte("<rdf:RDF")) && bytes.Contains(head, []byte("http://purl.org/rss/1.0/"))
+}
+
+// decodeXML unmarshals an XML file, converting legacy character sets to UTF-8.
+func decodeXML(data []byte, v interface{}) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = charset.NewReaderLabel
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	return d.Decode(v)
+}
+
+// opmlOutline is one node of an OPML outline. Outliners put the node text in text (or
+// title), a longer note in _note, and a link in url, htmlUrl or xmlUrl.
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr"`
+	Note     string        `xml:"_note,attr"`
+	URL      string        `xml:"url,attr"`
+	HTMLURL  string        `xml:"htmlUrl,attr"`
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	Children []opmlOutline `xml:"outline"`
+}
+
+// extractOPML turns an outline into Markdown: nodes with children become headings, one
+// level deeper for every level of the outline, and leaves become paragraphs. Outlines
+// nested deeper than Markdown headings continue as indented lists. Every top-level
+// node starts a new section, which becomes the location carried into the ingest output.
+func extractOPML(file string, data []byte) ([]sourceDocument, error) {
+	var opml struct {
+		Head struct {
+			Title       string `xml:"title"`
+			DateCreated string `xml:"dateCreated"`
+			OwnerName   string `xml:"ownerName"`
+		} `xml:"head"`
+		Body struct {
+			Outlines []opmlOutline `xml:"outline"`
+		} `xml:"body"`
+	}
+	if err := decodeXML(data, &opml); err != nil {
+		return nil, err
+	}
+
+	doc := sourceDocument{Title: strings.TrimSpace(opml.Head.Title), Meta: map[string]string{}}
+	if doc.Title == "" {
+		doc.Title = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	if opml.Head.OwnerName != "" {
+		doc.Meta["author"] = strings.TrimSpace(opml.Head.OwnerName)
+	}
+	if t, ok := parseFeedTime(opml.Head.DateCreated); ok {
+		doc.Meta["created"] = t
+	}
+
+	for _, o := range opml.Body.Outlines {
+		var text strings.Builder
+		if len(doc.Segments) == 0 {
+			text.WriteString("# " + doc.Title + "\n\n")
+		}
+		writeOutline(&text, o, 2)
+		if md := normaliseMarkdown(text.String()); md != "" {
+			doc.Segments = append(doc.Segments, sourceSegment{
+				Location: sourceLocation{Unit: "section", Start: strconv.Itoa(len(doc.Segments) + 1)},
+				Text:     md,
+			})
+		}
+	}
+	if len(doc.Segments) == 0 {
+		return nil, errors.New("empty outline")
+	}
+	return []sourceDocument{doc}, nil
+}
+
+// writeOutline renders o at the given heading level. Levels beyond 6 become list items
+// indented by how far they are nested past the last heading level.
+func writeOutline(out *strings.Builder, o opmlOutline, level int) {
+	text := strings.TrimSpace(o.Text)
+	if text == "" {
+		text = strings.TrimSpace(o.Title)
+	}
+	if link := firstNonEmpty(o.URL, o.HTMLURL, o.XMLURL); link != "" {
+		if text == "" {
+			text = link
+		}
+		text = "[" + text + "](" + link + ")"
+	}
+	note := strings.TrimSpace(o.Note)
+
+	switch {
+	case level > 6:
+		indent := strings.Repeat("  ", level-7)
+		if text != "" {
+			out.WriteString(indent + "- " + text + "\n")
+		}
+		if note != "" {
+			out.WriteString(indent + "  " + strings.ReplaceAll(note, "\n", "\n"+indent+"  ") + "\n")
+		}
+	case len(o.Children) > 0:
+		if text != "" {
+			out.WriteString("\n\n" + strings.Repeat("#", level) + " " + text + "\n\n")
+		}
+		if note != "" {
+			out.WriteString(note + "\n\n")
+		}
+	default:
+		out.WriteString("\n\n" + strings.TrimSpace(text+"\n\n"+note) + "\n\n")
+	}
+	for _, c := range o.Children {
+		if level == 6 && len(c.Children) == 0 {
+			// Leaves under the deepest heading stay paragraphs.
+			writeOutline(out, c, level)
+			continue
+		}
+		writeOutline(out, c, level+1)
+	}
+}
+
+// feedItem is an RSS item or Atom entry, read with the union of both vocabularies.
+type feedItem struct {
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Text string `xml:",chardata"`
+	} `xml:"link"`
+	GUID    string `xml:"guid"`
+	ID      string `xml:"id"`
+	Authors []struct {
+		Name string `xml:"name"` // Atom
+		Text string `xml:",chardata"`
+	} `xml:"author"`
+	Creator    []string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	PubDate    string   `xml:"pubDate"`
+	Published  string   `xml:"published"`
+	Updated    string   `xml:"updated"`
+	Date       string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Categories []struct {
+		Term string `xml:"term,attr"` // Atom
+		Text string `xml:",chardata"`
+	} `xml:"category"`
+	Description string   `xml:"description"`
+	Encoded     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Summary     feedText `xml:"summary"`
+	Content     feedText `xml:"content"`
+}
+
+// feedText is an Atom text construct, whose type says whether it holds text, escaped
+// HTML or inline XHTML.
+type feedText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+// html returns the construct as HTML.
+func (t feedText) html() string {
+	switch t.Type {
+	case "xhtml":
+		return t.Inner
+	case "text", "":
+		if strings.TrimSpace(t.Text) == "" {
+			return ""
+		}
+		if t.Type == "" && strings.Contains(t.Text, "<") {
+			return t.Text // RSS readers and some feeds put HTML in untyped content
+		}
+		var paras []string
+		for _, p := range strings.Split(strings.TrimSpace(t.Text), "\n\n") {
+			paras = append(paras, "<p>"+xmlEscape(p)+"</p>")
+		}
+		return strings.Join(paras, "")
+	default:
+		return t.Text
+	}
+}
+
+// extractFeed returns one document per RSS item or Atom entry, with its link, author,
+// date and categories as metadata. The item content is converted from HTML to Markdown.
+func extractFeed(file string, data []byte) ([]sourceDocument, error) {
+	var feed struct {
+		Title   string `xml:"title"`
+		Channel struct {
+			Title string     `xml:"title"`
+			Items []feedItem `xml:"item"`
+		} `xml:"channel"`
+		Items   []feedItem `xml:"item"`  // RSS 1.0 puts items next to the channel
+		Entries []feedItem `xml:"entry"` // Atom
+	}
+	if err := decodeXML(data, &feed); err != nil {
+		return nil, err
+	}
+	feedTitle := firstNonEmpty(feed.Channel.Title, feed.Title)
+	items := append(append(feed.Channel.Items, feed.Items...), feed.Entries...)
+
+	var docs []sourceDocument
+	for _, item := range items {
+		doc := feedDocument(item)
+		if doc.Title == "" {
+			continue
+		}
+		if feedTitle != "" {
+			doc.Meta["feed"] = strings.TrimSpace(feedTitle)
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) == 0 {
+		return nil, errors.New("no feed items found")
+	}
+	return docs, nil
+}
+
+// feedDocument converts one item. Items without a title are named after their first words.
+func feedDocument(item feedItem) sourceDocument {
+	body := firstNonEmpty(item.Encoded, item.Content.html(), item.Description, item.Summary.html())
+	var content string
+	if body != "" {
+		if root, err := parseHTMLFragment(body); err == nil {
+			content = htmlToMarkdown(root)
+		}
+	}
+
+	title := strings.TrimSpace(inlineWhitespace.ReplaceAllString(item.Title, " "))
+	if title == "" {
+		words := strings.Fields(content)
+		title = strings.Join(words[:min(len(words), 8)], " ")
+	}
+	doc := sourceDocument{Title: title, Meta: map[string]string{}}
+	if title == "" {
+		return doc
+	}
+
+	var link string
+	for _, l := range item.Links {
+		href := strings.TrimSpace(firstNonEmpty(l.Href, l.Text))
+		if href != "" && (l.Rel == "" || l.Rel == "alternate") {
+			link = href
+			break
+		}
+	}
+	if link == "" && strings.HasPrefix(item.GUID, "http") {
+		link = strings.TrimSpace(item.GUID)
+	}
+	set := func(key, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			doc.Meta[key] = value
+		}
+	}
+	set("url", link)
+	set("id", firstNonEmpty(item.GUID, item.ID))
+	authors := item.Creator
+	for _, a := range item.Authors {
+		authors = append(authors, firstNonEmpty(a.Name, a.Text))
+	}
+	set("author", strings.Join(nonEmpty(authors), ", "))
+	if t, ok := parseFeedTime(firstNonEmpty(item.Published, item.PubDate, item.Date, item.Updated)); ok {
+		doc.Meta["published"] = t
+	}
+	if t, ok := parseFeedTime(item.Updated); ok && item.Updated != firstNonEmpty(item.Published, item.PubDate, item.Date) {
+		doc.Meta["updated"] = t
+	}
+	var categories []string
+	for _, c := range item.Categories {
+		categories = append(categories, firstNonEmpty(c.Term, c.Text))
+	}
+	set("categories", strings.Join(nonEmpty(categories), ", "))
+
+	text := "# " + title
+	if content != "" {
+		text += "\n\n" + content
+	}
+	doc.Segments = []sourceSegment{{Text: text}}
+	return doc
+}
+
+// feedTimeLayouts are the date formats found in feeds: RFC 822 for RSS, RFC 3339 for
+// Atom and Dublin Core, and the usual deviations from both.
+var feedTimeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	"Mon, 02 Jan 06 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseFeedTime normalises a feed date to RFC 3339 in UTC.
+func parseFeedTime(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", false
+	}
+	for _, layout := range feedTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC().Format(time.RFC3339), true
+		}
+	}
+	return "", false
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func nonEmpty(values []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
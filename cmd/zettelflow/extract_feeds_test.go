@@ -0,0 +1,162 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testOPML = `<?xml version="1.0" encoding="ISO-8859-1"?>
+<opml version="2.0">
+<head><title>Reading List</title><ownerName>Ann</ownerName><dateCreated>Mon, 01 Apr 2024 09:00:00 GMT</dateCreated></head>
+<body>
+  <outline text="Books" _note="To read this year.">
+    <outline text="Smart Notes" url="https://example.com/notes"/>
+    <outline text="Caf&eacute; talk"/>
+  </outline>
+  <outline text="Loose idea"/>
+</body>
+</opml>`
+
+const testRSS = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+<channel><title>Example Blog</title>
+<item>
+  <title>First  post</title>
+  <link>https://example.com/first</link>
+  <guid isPermaLink="false">post-1</guid>
+  <dc:creator>Ann</dc:creator>
+  <pubDate>Tue, 02 Apr 2024 10:00:00 +0200</pubDate>
+  <category>notes</category><category>writing</category>
+  <description>Short summary.</description>
+  <content:encoded><![CDATA[<p>Full <b>text</b>.</p>]]></content:encoded>
+</item>
+<item>
+  <description>&lt;p&gt;An item without a title has its first words as title.&lt;/p&gt;</description>
+</item>
+<item><title></title></item>
+</channel></rss>`
+
+const testAtom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+<title>Atom Feed</title>
+<entry>
+  <title>Entry</title>
+  <link rel="self" href="https://example.com/self"/>
+  <link href="https://example.com/entry"/>
+  <id>urn:entry:1</id>
+  <author><name>Bob</name></author>
+  <published>2024-04-03T08:00:00Z</published>
+  <updated>2024-04-04T08:00:00Z</updated>
+  <category term="ideas"/>
+  <content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Inline <em>XHTML</em>.</p></div></content>
+</entry>
+<entry>
+  <title>Plain</title>
+  <summary type="text">First line &amp; more.
+
+Second paragraph.</summary>
+</entry>
+</feed>`
+
+func TestIsOPMLAndFeed(t *testing.T) {
+	tests := []struct {
+		file, data  string
+		opml, isRSS bool
+	}{
+		{"subscriptions.opml", "", true, false},
+		{"outline.xml", testOPML, true, false},
+		{"blog.rss", "", false, true},
+		{"blog.xml", testRSS, false, true},
+		{"atom.xml", testAtom, false, true},
+		{"rdf.xml", `<rdf:RDF xmlns="http://purl.org/rss/1.0/">`, false, true},
+		{"page.xml", `<feed><item/></feed>`, false, false},
+	}
+	for _, tt := range tests {
+		if got := isOPML(tt.file, []byte(tt.data)); got != tt.opml {
+			t.Errorf("isOPML(%q) = %v, want %v", tt.file, got, tt.opml)
+		}
+		if got := isFeed(tt.file, []byte(tt.data)); got != tt.isRSS {
+			t.Errorf("isFeed(%q) = %v, want %v", tt.file, got, tt.isRSS)
+		}
+	}
+}
+
+func TestExtractOPML(t *testing.T) {
+	docs, err := extractOPML("list.opml", []byte(testOPML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []sourceDocument{{
+		Title: "Reading List",
+		Meta:  map[string]string{"author": "Ann", "created": "2024-04-01T09:00:00Z"},
+		Segments: []sourceSegment{
+			{Location: sourceLocation{Unit: "section", Start: "1"}, Text: "# Reading List\n\n## Books\n\nTo read this year.\n\n[Smart Notes](https://example.com/notes)\n\nCafé talk"},
+			{Location: sourceLocation{Unit: "section", Start: "2"}, Text: "Loose idea"},
+		},
+	}}
+	if !reflect.DeepEqual(docs, want) {
+		t.Errorf("extractOPML() = %+v, want %+v", docs, want)
+	}
+
+	if _, err := extractOPML("empty.opml", []byte(`<opml><body/></opml>`)); err == nil {
+		t.Error("extractOPML() of an empty outline succeeded")
+	}
+}
+
+func TestExtractFeed(t *testing.T) {
+	tests := []struct {
+		name, data string
+		want       []sourceDocument
+	}{
+		{"rss", testRSS, []sourceDocument{
+			{Title: "First post", Meta: map[string]string{
+				"feed": "Example Blog", "url": "https://example.com/first", "id": "post-1", "author": "Ann",
+				"published": "2024-04-02T08:00:00Z", "categories": "notes, writing",
+			}, Segments: []sourceSegment{{Text: "# First post\n\nFull **text**."}}},
+			{Title: "An item without a title has its first", Meta: map[string]string{"feed": "Example Blog"},
+				Segments: []sourceSegment{{Text: "# An item without a title has its first\n\nAn item without a title has its first words as title."}}},
+		}},
+		{"atom", testAtom, []sourceDocument{
+			{Title: "Entry", Meta: map[string]string{
+				"feed": "Atom Feed", "url": "https://example.com/entry", "id": "urn:entry:1", "author": "Bob",
+				"published": "2024-04-03T08:00:00Z", "updated": "2024-04-04T08:00:00Z", "categories": "ideas",
+			}, Segments: []sourceSegment{{Text: "# Entry\n\nInline *XHTML*."}}},
+			{Title: "Plain", Meta: map[string]string{"feed": "Atom Feed"},
+				Segments: []sourceSegment{{Text: "# Plain\n\nFirst line & more.\n\nSecond paragraph."}}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractFeed("feed.xml", []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractFeed() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := extractFeed("empty.rss", []byte(`<rss><channel/></rss>`)); err == nil {
+		t.Error("extractFeed() without items succeeded")
+	}
+}
+
+func TestParseFeedTime(t *testing.T) {
+	tests := []struct {
+		s, want string
+		ok      bool
+	}{
+		{"Tue, 02 Apr 2024 10:00:00 +0200", "2024-04-02T08:00:00Z", true},
+		{"Tue, 2 Apr 2024 10:00:00 GMT", "2024-04-02T10:00:00Z", true},
+		{"2024-04-02T10:00:00.5+02:00", "2024-04-02T08:00:00Z", true},
+		{"2024-04-02", "2024-04-02T00:00:00Z", true},
+		{"yesterday", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := parseFeedTime(tt.s); got != tt.want || ok != tt.ok {
+			t.Errorf("parseFeedTime(%q) = %q, %v, want %q, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// isHTML detects saved web pages by extension or by a leading doctype/html tag.
+func isHTML(file string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".html", ".htm", ".xhtml":
+		return true
+	}
+	head := bytes.ToLower(bytes.TrimLeft(bytes.TrimPrefix(data[:min(len(data), 512)], []byte("\xef\xbb\xbf")), " \t\r\n"))
+	return bytes.HasPrefix(head, []byte("<!doctype html")) || bytes.HasPrefix(head, []byte("<html"))
+}
+
+// extractHTML keeps only the main content of a saved web page, converted to Markdown,
+// and records the page title, canonical URL, author and publish date as metadata.
+func extractHTML(file string, data []byte) ([]sourceDocument, error) {
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	meta := readHTMLMeta(root)
+	if base := meta["url"]; base != "" {
+		resolveLinks(root, base)
+	}
+
+	content := readableContent(root)
+	if content == "" {
+		return nil, errors.New("no readable content found")
+	}
+	title := meta["title"]
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	if !strings.HasPrefix(content, "# ") {
+		content = "# " + title + "\n\n" + content
+	}
+
+	return []sourceDocument{{
+		Title:    title,
+		Meta:     meta,
+		Segments: []sourceSegment{{Text: content}},
+	}}, nil
+}
+
+// readHTMLMeta collects source metadata from <title>, <link rel=canonical>, meta tags
+// (including Open Graph and article:*) and JSON-LD blocks, preferring the most specific.
+func readHTMLMeta(root *html.Node) map[string]string {
+	meta := map[string]string{}
+	set := func(key, value string) {
+		value = strings.TrimSpace(inlineWhitespace.ReplaceAllString(value, " "))
+		if value != "" && meta[key] == "" {
+			meta[key] = value
+		}
+	}
+
+	var ldJSON []string
+	var titleTag string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Title:
+				if titleTag == "" {
+					titleTag = textContent(n)
+				}
+			case atom.Link:
+				if strings.EqualFold(attr(n, "rel"), "canonical") {
+					set("url", attr(n, "href"))
+				}
+			case atom.Meta:
+				key := strings.ToLower(attr(n, "property"))
+				if key == "" {
+					key = strings.ToLower(attr(n, "name"))
+				}
+				if key == "" {
+					key = strings.ToLower(attr(n, "itemprop"))
+				}
+				value := attr(n, "content")
+				switch key {
+				case "og:title", "twitter:title":
+					set("title", value)
+				case "og:url":
+					set("url", value)
+				case "author", "article:author", "dc.creator", "parsely-author", "sailthru.author":
+					set("author", value)
+				case "article:published_time", "datepublished", "date", "dc.date", "dc.date.issued", "parsely-pub-date", "pubdate":
+					set("published", value)
+				}
+			case atom.Script:
+				if strings.EqualFold(attr(n, "type"), "application/ld+json") {
+					ldJSON = append(ldJSON, textContent(n))
+				}
+			case atom.Time:
+				if dt := attr(n, "datetime"); dt != "" && strings.Contains(attr(n, "itemprop")+attr(n, "class"), "publish") {
+					set("published", dt)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	for _, raw := range ldJSON {
+		readLDJSON(raw, set)
+	}
+	set("title", titleTag)
+	return meta
+}
+
+// readLDJSON picks headline, author and datePublished out of schema.org JSON-LD.
+func readLDJSON(raw string, set func(key, value string)) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return
+	}
+	var visit func(interface{})
+	visit = func(v interface{}) {
+		switch t := v.(type) {
+		case []interface{}:
+			for _, item := range t {
+				visit(item)
+			}
+		case map[string]interface{}:
+			if s, ok := t["headline"].(string); ok {
+				set("title", s)
+			}
+			if s, ok := t["datePublished"].(string); ok {
+				set("published", s)
+			}
+			switch a := t["author"].(type) {
+			case string:
+				set("author", a)
+			case map[string]interface{}:
+				if s, ok := a["name"].(string); ok {
+					set("author", s)
+				}
+			case []interface{}:
+				if len(a) > 0 {
+					if m, ok := a[0].(map[string]interface{}); ok {
+						if s, ok := m["name"].(string); ok {
+							set("author", s)
+						}
+					}
+				}
+			}
+			if graph, ok := t["@graph"]; ok {
+				visit(graph)
+			}
+		}
+	}
+	visit(v)
+}
+
+// resolveLinks makes relative link and image targets absolute against the page URL.
+func resolveLinks(n *html.Node, base string) {
+	baseURL, err := url.Parse(base)
+	if err != nil || !baseURL.IsAbs() {
+		return
+	}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for i, a := range n.Attr {
+				if (a.Key == "href" && n.DataAtom == atom.A) || (a.Key == "src" && n.DataAtom == atom.Img) {
+					if ref, err := url.Parse(a.Val); err == nil && !strings.HasPrefix(a.Val, "#") {
+						n.Attr[i].Val = baseURL.ResolveReference(ref).String()
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+}
+
+var (
+	unlikelyCandidate = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|footer|gdpr|header|legends|menu|modal|nav|pager|popup|promo|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|supplemental|ad-break|agegate|pagination|widget`)
+	maybeCandidate    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow|post|entry|story|text`)
+	positiveClass     = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|pagination|post|text|blog|story`)
+	negativeClass     = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|foot|footer|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// readableContent performs readability-style main content detection: boilerplate is
+// pruned, paragraphs award points to their ancestors, and the best scoring container
+// (adjusted for link density) is converted to Markdown together with related siblings.
+func readableContent(root *html.Node) string {
+	body := findElement(root, atom.Body)
+	if body == nil {
+		body = root
+	}
+	pruneBoilerplate(body)
+
+	scores := map[*html.Node]float64{}
+	var candidates []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if n.Type != html.ElementNode || (n.DataAtom != atom.P && n.DataAtom != atom.Pre && n.DataAtom != atom.Td) {
+			return
+		}
+		text := strings.TrimSpace(textContent(n))
+		if len(text) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+		for level, ancestor := 0, n.Parent; ancestor != nil && level < 3; level, ancestor = level+1, ancestor.Parent {
+			if ancestor.Type != html.ElementNode {
+				break
+			}
+			if _, ok := scores[ancestor]; !ok {
+				scores[ancestor] = initialScore(ancestor)
+				candidates = append(candidates, ancestor)
+			}
+			switch level {
+			case 0:
+				scores[ancestor] += score
+			case 1:
+				scores[ancestor] += score / 2
+			default:
+				scores[ancestor] += score / float64(level*3)
+			}
+		}
+	}
+	walk(body)
+
+	var top *html.Node
+	best := 0.0
+	for _, c := range candidates {
+		scores[c] *= 1 - linkDensity(c)
+		if top == nil || scores[c] > best {
+			top, best = c, scores[c]
+		}
+	}
+	if top == nil {
+		return htmlToMarkdown(body)
+	}
+
+	// Pull in siblings that look like part of the same article, e.g. an intro paragraph
+	// outside the highest scoring container.
+	threshold := math.Max(10, best*0.2)
+	var parts []string
+	if top.Parent == nil {
+		return htmlToMarkdown(top)
+	}
+	for s := top.Parent.FirstChild; s != nil; s = s.NextSibling {
+		if s.Type != html.ElementNode {
+			continue
+		}
+		include := s == top
+		if score, ok := scores[s]; ok && score >= threshold {
+			include = true
+		}
+		if s.DataAtom == atom.P {
+			text := strings.TrimSpace(textContent(s))
+			if len(text) > 80 && linkDensity(s) < 0.25 {
+				include = true
+			}
+		}
+		if include {
+			parts = append(parts, htmlToMarkdown(s))
+		}
+	}
+	return normaliseMarkdown(strings.Join(parts, "\n\n"))
+}
+
+// pruneBoilerplate removes elements that are never part of an article body.
+func pruneBoilerplate(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode {
+			n.RemoveChild(c)
+		} else if c.Type == html.ElementNode {
+			remove := false
+			switch c.DataAtom {
+			case atom.Script, atom.Style, atom.Noscript, atom.Nav, atom.Footer, atom.Aside, atom.Form, atom.Iframe, atom.Button:
+				remove = true
+			case atom.Body, atom.Article, atom.Main, atom.A, atom.Table, atom.Pre, atom.Code:
+			default:
+				match := attr(c, "class") + " " + attr(c, "id") + " " + attr(c, "role")
+				remove = unlikelyCandidate.MatchString(match) && !maybeCandidate.MatchString(match)
+			}
+			if hasAttr(c, "hidden") || strings.Contains(strings.ReplaceAll(attr(c, "style"), " ", ""), "display:none") {
+				remove = true
+			}
+			if remove {
+				n.RemoveChild(c)
+			} else {
+				pruneBoilerplate(c)
+			}
+		}
+		c = next
+	}
+}
+
+// initialScore weights a candidate container by its tag and class names.
+func initialScore(n *html.Node) float64 {
+	score := 0.0
+	switch n.DataAtom {
+	case atom.Article:
+		score += 10
+	case atom.Div, atom.Main, atom.Section:
+		score += 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score += 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		score -= 3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score -= 5
+	}
+	for _, name := range []string{attr(n, "class"), attr(n, "id")} {
+		if name == "" {
+			continue
+		}
+		if negativeClass.MatchString(name) {
+			score -= 25
+		}
+		if positiveClass.MatchString(name) {
+			score += 25
+		}
+	}
+	return score
+}
+
+// linkDensity is the share of an element's text that sits inside links.
+func linkDensity(n *html.Node) float64 {
+	total := len(strings.TrimSpace(textContent(n)))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			linked += len(strings.TrimSpace(textContent(n)))
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return float64(linked) / float64(total)
+}
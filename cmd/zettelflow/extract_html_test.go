@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsHTML(t *testing.T) {
+	tests := []struct {
+		file, data string
+		want       bool
+	}{
+		{"page.html", "anything", true},
+		{"page.HTM", "", true},
+		{"saved", "\xef\xbb\xbf  <!DOCTYPE html><html></html>", true},
+		{"saved", "<html lang=en>", true},
+		{"notes.md", "# Notes\n\nSee <html> tags.", false},
+	}
+	for _, tt := range tests {
+		if got := isHTML(tt.file, []byte(tt.data)); got != tt.want {
+			t.Errorf("isHTML(%q, %q) = %v, want %v", tt.file, tt.data, got, tt.want)
+		}
+	}
+}
+
+const articlePage = `<!doctype html>
+<html><head>
+<title>Page Title</title>
+<link rel="canonical" href="https://example.com/post">
+<meta name="author" content="Ada Lovelace">
+</head><body>
+<nav><a href="/">Home</a></nav>
+<article>
+<h1>Atomic Notes</h1>
+<p>An atomic note holds exactly one idea, written so that it can be understood on its own. See <a href="/more">more</a>.</p>
+<p>Linking such notes builds a web of thought that grows more useful with every note added to it.</p>
+<div hidden><p>Hidden teaser text that must not appear in the note at all.</p></div>
+<div style="display: none"><p>Invisible tracking paragraph that must not appear either.</p></div>
+</article>
+<footer>Copyright</footer>
+</body></html>`
+
+func TestExtractHTML(t *testing.T) {
+	docs, err := extractHTML("post.html", []byte(articlePage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 {
+		t.Fatalf("extractHTML() returned %d documents, want 1", len(docs))
+	}
+	doc := docs[0]
+	if doc.Title != "Page Title" {
+		t.Errorf("Title = %q, want %q", doc.Title, "Page Title")
+	}
+	if doc.Meta["url"] != "https://example.com/post" || doc.Meta["author"] != "Ada Lovelace" {
+		t.Errorf("Meta = %v, want the canonical URL and the author", doc.Meta)
+	}
+	text := joinSegments(doc.Segments)
+	for _, want := range []string{"# Atomic Notes", "exactly one idea", "[more](https://example.com/more)"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("content %q does not contain %q", text, want)
+		}
+	}
+	for _, unwanted := range []string{"Hidden teaser", "Invisible tracking", "Home", "Copyright"} {
+		if strings.Contains(text, unwanted) {
+			t.Errorf("content %q contains %q", text, unwanted)
+		}
+	}
+}
+
+func TestExtractHTMLEmpty(t *testing.T) {
+	if _, err := extractHTML("empty.html", []byte("<html><body><nav>Menu</nav></body></html>")); err == nil {
+		t.Error("extractHTML() of a page without content succeeded")
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// kindleSeparator ends every entry of a My Clippings.txt file.
+const kindleSeparator = "=========="
+
+// isKindle detects the My Clippings.txt file of a Kindle and the HTML notebook export of
+// the Kindle apps. Both are otherwise indistinguishable from plain text and web pages.
+func isKindle(file string, data []byte) bool {
+	if strings.EqualFold(filepath.Base(file), "My Clippings.txt") {
+		return true
+	}
+	head := data[:min(len(data), 4096)]
+	if kindleEntry.Match(head) {
+		return true
+	}
+	return bytes.Contains(head, []byte(`class="bookTitle"`)) && bytes.Contains(data, []byte(`class="noteHeading"`))
+}
+
+// kindleClipping is one highlight or note, in the order the Kindle recorded it.
+type kindleClipping struct {
+	Book    string
+	Author  string
+	Kind    string // "highlight" or "note"
+	Page    string
+	Start   int
+	End     int
+	AddedAt time.Time
+	Text    string
+	Notes   []string
+}
+
+var (
+	// - Your Highlight on page 12 | Location 180-182 | Added on Tuesday, March 3, 2020 10:12:13 AM
+	kindleEntry    = regexp.MustCompile(`(?m)^- [^\n|]+\|[^\n]*\n(?:\r?\n)?[\s\S]*?^==========\r?$`)
+	kindleMetaLine = regexp.MustCompile(`(?m)^- (?:Your |La tua |Ihre |Votre |Tu )?(\S+)`)
+	kindleLocation = regexp.MustCompile(`(?i)(?:location|loc\.|position|posizione|emplacement|posición)\s+(\d+)(?:-(\d+))?`)
+	kindlePage     = regexp.MustCompile(`(?i)(?:page|seite|pagina|página)\s+([\w]+)(?:-[\w]+)?`)
+	kindleAdded    = regexp.MustCompile(`(?i)added on (.+)$`)
+	kindleAuthor   = regexp.MustCompile(`^(.*\S)\s*\(([^()]*)\)$`)
+)
+
+// kindleDateLayouts are the "Added on" formats written by English-language Kindles.
+var kindleDateLayouts = []string{
+	"Monday, January 2, 2006 3:04:05 PM",
+	"Monday, 2 January 2006 15:04:05",
+	"Monday, January 2, 2006, 3:04 PM",
+}
+
+// extractKindle groups Kindle highlights and notes by book and returns one document per
+// book, with each highlight as a segment located by its Kindle location.
+func extractKindle(file string, data []byte) ([]sourceDocument, error) {
+	var clippings []kindleClipping
+	var err error
+	if bytes.Contains(data, []byte(`class="noteHeading"`)) {
+		clippings, err = parseKindleNotebook(data)
+	} else {
+		clippings = parseKindleClippings(string(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(clippings) == 0 {
+		return nil, errors.New("no highlights or notes found")
+	}
+	return kindleDocuments(clippings), nil
+}
+
+// parseKindleClippings reads the entries of a My Clippings.txt file. Bookmarks and
+// entries without text are ignored.
+func parseKindleClippings(content string) []kindleClipping {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	var clippings []kindleClipping
+	for _, entry := range strings.Split(content, kindleSeparator) {
+		lines := strings.Split(strings.Trim(entry, "\n\ufeff "), "\n")
+		if len(lines) < 2 {
+			continue
+		}
+		book, author := kindleBook(lines[0])
+		meta := lines[1]
+		m := kindleMetaLine.FindStringSubmatch(meta)
+		if m == nil {
+			continue
+		}
+		text := strings.TrimSpace(strings.Join(lines[2:], "\n"))
+		kind := strings.ToLower(m[1])
+		if text == "" || strings.HasPrefix(kind, "bookmark") || strings.HasPrefix(kind, "segnalibro") || strings.HasPrefix(kind, "lesezeichen") || strings.HasPrefix(kind, "signet") || strings.HasPrefix(kind, "marcador") {
+			continue
+		}
+		c := kindleClipping{Book: book, Author: author, Kind: "highlight", Text: text}
+		if strings.HasPrefix(kind, "note") || strings.HasPrefix(kind, "notiz") || strings.HasPrefix(kind, "nota") {
+			c.Kind = "note"
+		}
+		c.Page, c.Start, c.End = kindlePosition(meta)
+		if a := kindleAdded.FindStringSubmatch(meta); a != nil {
+			for _, layout := range kindleDateLayouts {
+				if t, err := time.Parse(layout, strings.TrimSpace(a[1])); err == nil {
+					c.AddedAt = t
+					break
+				}
+			}
+		}
+		clippings = append(clippings, c)
+	}
+	return clippings
+}
+
+// parseKindleNotebook reads the HTML notebook exported by the Kindle apps, where every
+// highlight or note is a noteHeading followed by its noteText.
+func parseKindleNotebook(data []byte) ([]kindleClipping, error) {
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var book, author string
+	var clippings []kindleClipping
+	var heading string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			text := strings.TrimSpace(inlineWhitespace.ReplaceAllString(textContent(n), " "))
+			switch strings.TrimSpace(attr(n, "class")) {
+			case "bookTitle":
+				book = text
+				return
+			case "authors":
+				author = text
+				return
+			case "noteHeading":
+				heading = text
+				return
+			case "noteText":
+				if heading == "" || text == "" {
+					return
+				}
+				c := kindleClipping{Book: book, Author: author, Kind: "highlight", Text: text}
+				if strings.HasPrefix(strings.ToLower(heading), "note") {
+					c.Kind = "note"
+				}
+				c.Page, c.Start, c.End = kindlePosition(heading)
+				clippings = append(clippings, c)
+				heading = ""
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return clippings, nil
+}
+
+// kindleBook splits "Title (Author)" into its parts.
+func kindleBook(line string) (string, string) {
+	line = strings.TrimSpace(strings.TrimPrefix(line, "\ufeff"))
+	if m := kindleAuthor.FindStringSubmatch(line); m != nil {
+		return m[1], strings.TrimSpace(m[2])
+	}
+	return line, ""
+}
+
+// kindlePosition reads the page and location range out of a clipping's metadata.
+func kindlePosition(meta string) (page string, start, end int) {
+	if m := kindlePage.FindStringSubmatch(meta); m != nil {
+		page = m[1]
+	}
+	if m := kindleLocation.FindStringSubmatch(meta); m != nil {
+		start, _ = strconv.Atoi(m[1])
+		end = start
+		if m[2] != "" {
+			end, _ = strconv.Atoi(m[2])
+			// Kindles abbreviate ranges such as 1012-15.
+			if end < start && len(m[2]) < len(m[1]) {
+				end, _ = strconv.Atoi(m[1][:len(m[1])-len(m[2])] + m[2])
+			}
+		}
+	}
+	return page, start, end
+}
+
+// kindleDocuments groups clippings by book. Re-highlighted passages, which the Kindle
+// records as an additional clipping, are collapsed into the latest version, and notes
+// are attached to the highlight they were made on.
+func kindleDocuments(clippings []kindleClipping) []sourceDocument {
+	var order []string
+	books := map[string][]kindleClipping{}
+	authors := map[string]string{}
+	for _, c := range clippings {
+		key := c.Book
+		if _, ok := books[key]; !ok {
+			order = append(order, key)
+			authors[key] = c.Author
+		}
+		books[key] = append(books[key], c)
+	}
+
+	var docs []sourceDocument
+	for _, book := range order {
+		var highlights []kindleClipping
+		var notes []kindleClipping
+		for _, c := range books[book] {
+			if c.Kind == "note" {
+				notes = append(notes, c)
+				continue
+			}
+			highlights = addHighlight(highlights, c)
+		}
+		for _, n := range notes {
+			attached := false
+			for i := range highlights {
+				h := &highlights[i]
+				if n.Start != 0 && n.Start >= h.Start && n.Start <= h.End {
+					h.Notes = append(h.Notes, n.Text)
+					attached = true
+					break
+				}
+			}
+			if !attached {
+				highlights = append(highlights, n)
+			}
+		}
+		sort.SliceStable(highlights, func(i, j int) bool { return highlights[i].Start < highlights[j].Start })
+
+		doc := sourceDocument{Title: book, Meta: map[string]string{}}
+		if authors[book] != "" {
+			doc.Meta["author"] = authors[book]
+		}
+		for i, h := range highlights {
+			var text strings.Builder
+			if i == 0 {
+				text.WriteString("# " + book + "\n\n")
+			}
+			if h.Kind == "note" {
+				text.WriteString("**Note:** " + h.Text)
+			} else {
+				text.WriteString("> " + strings.ReplaceAll(h.Text, "\n", "\n> "))
+				for _, n := range h.Notes {
+					text.WriteString("\n\n**Note:** " + n)
+				}
+			}
+			doc.Segments = append(doc.Segments, sourceSegment{Location: h.location(), Text: text.String()})
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// addHighlight adds c to the highlights of a book, replacing an earlier clipping of
+// the same passage: one at the same location, or an overlapping one whose text the
+// new highlight contains or extends.
+func addHighlight(highlights []kindleClipping, c kindleClipping) []kindleClipping {
+	text := normaliseClipping(c.Text)
+	for i, h := range highlights {
+		if c.Start == 0 || h.Start == 0 {
+			if normaliseClipping(h.Text) == text {
+				return highlights
+			}
+			continue
+		}
+		if c.Start > h.End || h.Start > c.End {
+			continue
+		}
+		old := normaliseClipping(h.Text)
+		if (c.Start == h.Start && c.End == h.End) || strings.Contains(text, old) || strings.Contains(old, text) {
+			// The later clipping is the one the reader settled on.
+			if !c.AddedAt.IsZero() && !h.AddedAt.IsZero() && c.AddedAt.Before(h.AddedAt) {
+				return highlights
+			}
+			highlights[i] = c
+			return highlights
+		}
+	}
+	return append(highlights, c)
+}
+
+func normaliseClipping(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// location prefers Kindle locations, which every book has, over page numbers.
+func (c kindleClipping) location() sourceLocation {
+	if c.Start != 0 {
+		l := sourceLocation{Unit: "location", Start: strconv.Itoa(c.Start)}
+		if c.End > c.Start {
+			l.End = strconv.Itoa(c.End)
+		}
+		return l
+	}
+	if c.Page != "" {
+		return sourceLocation{Unit: "page", Start: c.Page}
+	}
+	return sourceLocation{}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const kindleClippings = "\ufeffHow to Take Smart Notes (Sönke Ahrens)\r\n" +
+	"- Your Highlight on page 12 | Location 180-182 | Added on Tuesday, March 3, 2020 10:12:13 AM\r\n\r\n" +
+	"Writing is not the outcome of thinking\r\n==========\r\n" +
+	"How to Take Smart Notes (Sönke Ahrens)\r\n" +
+	"- Your Highlight on page 12 | Location 180-185 | Added on Tuesday, March 3, 2020 10:14:00 AM\r\n\r\n" +
+	"Writing is not the outcome of thinking; it is the medium.\r\n==========\r\n" +
+	"How to Take Smart Notes (Sönke Ahrens)\r\n" +
+	"- Your Note on page 12 | Location 183 | Added on Tuesday, March 3, 2020 10:15:00 AM\r\n\r\n" +
+	"Key idea.\r\n==========\r\n" +
+	"How to Take Smart Notes (Sönke Ahrens)\r\n" +
+	"- Your Bookmark on page 20 | Location 300 | Added on Tuesday, March 3, 2020 10:16:00 AM\r\n\r\n\r\n==========\r\n" +
+	"How to Take Smart Notes (Sönke Ahrens)\r\n" +
+	"- Your Highlight on page 5 | Location 1012-15 | Added on Tuesday, March 3, 2020 10:17:00 AM\r\n\r\n" +
+	"Read with a pen in hand.\r\n==========\r\n" +
+	"Untitled Draft\r\n" +
+	"- Your Highlight on page 3 | Added on Wednesday, March 4, 2020 9:00:00 AM\r\n\r\n" +
+	"A clipping without a location.\r\n==========\r\n"
+
+const kindleNotebook = `<html><body>
+<div class="bookTitle">Thinking, Fast and Slow</div>
+<div class="authors">Daniel Kahneman</div>
+<div class="noteHeading">Highlight (yellow) - Page 20 · Location 301</div>
+<div class="noteText">System 1 operates automatically.</div>
+<div class="noteHeading">Note - Page 20 · Location 301</div>
+<div class="noteText">Compare with habits.</div>
+</body></html>`
+
+func TestIsKindle(t *testing.T) {
+	tests := []struct {
+		file, data string
+		want       bool
+	}{
+		{"My Clippings.txt", "", true},
+		{"clippings-2020.txt", kindleClippings, true},
+		{"notebook.html", kindleNotebook, true},
+		{"page.html", `<div class="bookTitle">Not a notebook</div>`, false},
+		{"notes.txt", "- a list item | with a pipe\n\ntext\n", false},
+	}
+	for _, tt := range tests {
+		if got := isKindle(tt.file, []byte(tt.data)); got != tt.want {
+			t.Errorf("isKindle(%q) = %v, want %v", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestExtractKindle(t *testing.T) {
+	tests := []struct {
+		name, data string
+		want       []sourceDocument
+	}{
+		{"clippings", kindleClippings, []sourceDocument{
+			{Title: "How to Take Smart Notes", Meta: map[string]string{"author": "Sönke Ahrens"}, Segments: []sourceSegment{
+				{Location: sourceLocation{Unit: "location", Start: "180", End: "185"}, Text: "# How to Take Smart Notes\n\n> Writing is not the outcome of thinking; it is the medium.\n\n**Note:** Key idea."},
+				{Location: sourceLocation{Unit: "location", Start: "1012", End: "1015"}, Text: "> Read with a pen in hand."},
+			}},
+			{Title: "Untitled Draft", Meta: map[string]string{}, Segments: []sourceSegment{
+				{Location: sourceLocation{Unit: "page", Start: "3"}, Text: "# Untitled Draft\n\n> A clipping without a location."},
+			}},
+		}},
+		{"notebook", kindleNotebook, []sourceDocument{
+			{Title: "Thinking, Fast and Slow", Meta: map[string]string{"author": "Daniel Kahneman"}, Segments: []sourceSegment{
+				{Location: sourceLocation{Unit: "location", Start: "301"}, Text: "# Thinking, Fast and Slow\n\n> System 1 operates automatically.\n\n**Note:** Compare with habits."},
+			}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractKindle("My Clippings.txt", []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractKindle() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := extractKindle("My Clippings.txt", []byte("")); err == nil {
+		t.Error("extractKindle() without clippings succeeded")
+	}
+}
+
+func TestKindleHighlightLocations(t *testing.T) {
+	docs, err := extractKindle("My Clippings.txt", []byte(kindleClippings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A response that keeps the markers of the prompt input, as the prompt asks.
+	prompt := ingestPrompt("{input_text}", docs[0].Segments)
+	response := strings.TrimSuffix(prompt, "\n\n"+locationInstruction)
+
+	var locator chunkLocator
+	var got []string
+	for i, chunk := range strings.Split(response, "\n\n<!--") {
+		if i > 0 {
+			chunk = "<!--" + chunk
+		}
+		_, location := locator.locate(chunk)
+		got = append(got, location)
+	}
+	if want := []string{"location 180-185", "location 1012-1015"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("note locations = %q, want one per highlight %q", got, want)
+	}
+}
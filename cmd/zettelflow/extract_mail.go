@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+var (
+	// From sender@example.com Tue Mar  3 10:00:00 2020, followed by the first header.
+	mboxStart = regexp.MustCompile(`^From \S+[^\n]*\r?\n[\w-]+:`)
+	// >From, >>From, … are escaped "From " lines in the body (mboxrd).
+	mboxEscapedFrom = regexp.MustCompile(`^>+From `)
+	headerLine      = regexp.MustCompile(`^[\x21-\x39\x3b-\x7e]+:`)
+)
+
+// isMbox detects mbox mailboxes by extension or by their leading "From " line.
+func isMbox(file string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".mbox", ".mbx":
+		return true
+	}
+	return mboxStart.Match(data[:min(len(data), 1024)])
+}
+
+// isEmail detects a single RFC 5322 message, such as an .eml file or a file of a
+// Maildir: a header block with a From field and at least one other message header.
+func isEmail(file string, data []byte) bool {
+	if strings.EqualFold(filepath.Ext(file), ".eml") {
+		return true
+	}
+	head := string(data[:min(len(data), 8192)])
+	end := strings.Index(head, "\n\n")
+	if end == -1 {
+		end = strings.Index(head, "\r\n\r\n")
+	}
+	if end == -1 {
+		return false
+	}
+	fields := map[string]bool{}
+	for _, line := range strings.Split(strings.ReplaceAll(head[:end], "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue // folded header
+		}
+		if !headerLine.MatchString(line) {
+			return false
+		}
+		fields[strings.ToLower(line[:strings.IndexByte(line, ':')])] = true
+	}
+	return fields["from"] && (fields["date"] || fields["message-id"] || fields["received"] || fields["return-path"] || fields["mime-version"])
+}
+
+// isMaildir reports whether dir is a Maildir, i.e. has cur, new and tmp subdirectories.
+func isMaildir(dir string) bool {
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if info, err := os.Stat(filepath.Join(dir, sub)); err != nil || !info.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+// extractEmail turns one message into a document.
+func extractEmail(file string, data []byte) ([]sourceDocument, error) {
+	doc, err := emailDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	return []sourceDocument{doc}, nil
+}
+
+// extractMbox returns one document per message of an mbox mailbox. Each document is
+// located by the message's position in the mailbox.
+func extractMbox(file string, data []byte) ([]sourceDocument, error) {
+	var docs []sourceDocument
+	for i, message := range splitMbox(data) {
+		doc, err := emailDocument(message)
+		if err != nil {
+			continue // a damaged message should not cost the rest of the mailbox
+		}
+		for j := range doc.Segments {
+			doc.Segments[j].Location = sourceLocation{Unit: "message", Start: strconv.Itoa(i + 1)}
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) == 0 {
+		return nil, errors.New("no messages found")
+	}
+	return docs, nil
+}
+
+// splitMbox cuts a mailbox at its "From " separator lines and undoes the >From
+// escaping of message bodies.
+func splitMbox(data []byte) [][]byte {
+	var messages [][]byte
+	var current bytes.Buffer
+	inMessage := false
+	previousBlank := true
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64<<10), len(data)+1)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if previousBlank && bytes.HasPrefix(line, []byte("From ")) {
+			if inMessage {
+				messages = append(messages, bytes.Clone(current.Bytes()))
+			}
+			current.Reset()
+			inMessage = true
+			previousBlank = false
+			continue
+		}
+		previousBlank = len(bytes.TrimRight(line, "\r")) == 0
+		if !inMessage {
+			continue
+		}
+		if mboxEscapedFrom.Match(line) {
+			line = line[1:]
+		}
+		current.Write(line)
+		current.WriteByte('\n')
+	}
+	if inMessage {
+		messages = append(messages, current.Bytes())
+	}
+	return messages
+}
+
+// headerDecoder decodes RFC 2047 encoded words in any character set.
+var headerDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+// emailDocument decodes a message: its subject becomes the title, its headers the
+// metadata, and its body Markdown. HTML parts are preferred over plain text, as they
+// keep the links and structure of a newsletter; attachments are ignored.
+func emailDocument(data []byte) (sourceDocument, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return sourceDocument{}, err
+	}
+	header := func(name string) string {
+		value := msg.Header.Get(name)
+		if decoded, err := headerDecoder.DecodeHeader(value); err == nil {
+			value = decoded
+		}
+		return strings.TrimSpace(inlineWhitespace.ReplaceAllString(value, " "))
+	}
+
+	doc := sourceDocument{Title: header("Subject"), Meta: map[string]string{}}
+	for key, name := range map[string]string{
+		"from":       "From",
+		"to":         "To",
+		"subject":    "Subject",
+		"message_id": "Message-ID",
+		"list_id":    "List-Id",
+	} {
+		if value := header(name); value != "" {
+			doc.Meta[key] = value
+		}
+	}
+	if date, err := msg.Header.Date(); err == nil {
+		doc.Meta["date"] = date.UTC().Format(time.RFC3339)
+	}
+
+	var body mailBody
+	if err := body.read(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body); err != nil {
+		return sourceDocument{}, err
+	}
+	content := body.markdown()
+	if doc.Title == "" {
+		doc.Title = "Untitled message"
+	}
+	text := content
+	if !strings.HasPrefix(content, "# ") {
+		text = strings.TrimSpace("# " + doc.Title + "\n\n" + content)
+	}
+	doc.Segments = []sourceSegment{{Text: text}}
+	return doc, nil
+}
+
+// mailBody collects the text parts of a message.
+type mailBody struct {
+	plain []string
+	html  []string
+}
+
+// read decodes a (possibly multipart) body. Parts of a multipart/alternative are all
+// read; markdown later picks the richer representation.
+func (b *mailBody) read(contentType, encoding string, r io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		parts := multipart.NewReader(r, params["boundary"])
+		for {
+			part, err := parts.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			disposition, _, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+			if disposition == "attachment" {
+				continue
+			}
+			if err := b.read(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part); err != nil {
+				return err
+			}
+		}
+	}
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return nil
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	text := decodeText(data)
+	if cs := params["charset"]; cs != "" {
+		if cr, err := charset.NewReaderLabel(cs, bytes.NewReader(data)); err == nil {
+			if decoded, err := io.ReadAll(cr); err == nil {
+				text = strings.ReplaceAll(string(decoded), "\r\n", "\n")
+			}
+		}
+	}
+	if mediaType == "text/html" {
+		b.html = append(b.html, text)
+	} else {
+		b.plain = append(b.plain, text)
+	}
+	return nil
+}
+
+// markdown renders the HTML parts through the readable-content extraction used for web
+// pages, falling back to the plain text parts.
+func (b *mailBody) markdown() string {
+	var parts []string
+	for _, h := range b.html {
+		root, err := parseHTMLFragment(h)
+		if err != nil {
+			continue
+		}
+		if md := readableContent(root); md != "" {
+			parts = append(parts, md)
+		}
+	}
+	if len(parts) == 0 {
+		for _, p := range b.plain {
+			if p = strings.TrimSpace(p); p != "" {
+				parts = append(parts, p)
+			}
+		}
+	}
+	return normaliseMarkdown(strings.Join(parts, "\n\n"))
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testEmail = "From: =?UTF-8?Q?J=C3=BCrgen?= <news@example.com>\r\n" +
+	"To: me@example.com\r\n" +
+	"Subject: =?UTF-8?B?V2Vla2x5IE5vdGVz?=\r\n" +
+	"Date: Tue, 02 Apr 2024 10:00:00 +0200\r\n" +
+	"Message-ID: <1@example.com>\r\n" +
+	"List-Id: Weekly <weekly.example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Plain version.\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=iso-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"<html><body><p>The HTML version is preferred, with a <a href=3D\"https://example.com/read\">link</a>=\r\n" +
+	" and Gr=FC=DFe.</p></body></html>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Disposition: attachment; filename=notes.txt\r\n" +
+	"\r\n" +
+	"Attached text that must be ignored.\r\n" +
+	"--outer--\r\n"
+
+const testMbox = "From alice@example.com Tue Mar  3 10:00:00 2020\n" +
+	"From: Alice <alice@example.com>\n" +
+	"Subject: First\n" +
+	"Date: Tue, 03 Mar 2020 10:00:00 +0000\n" +
+	"\n" +
+	"Hello.\n" +
+	">From the archive.\n" +
+	"\n" +
+	"From bob@example.com Wed Mar  4 10:00:00 2020\n" +
+	"From: Bob <bob@example.com>\n" +
+	"Date: Wed, 04 Mar 2020 10:00:00 +0000\n" +
+	"\n" +
+	"No subject here.\n"
+
+func TestIsMboxAndEmail(t *testing.T) {
+	tests := []struct {
+		file, data  string
+		mbox, email bool
+	}{
+		{"archive.mbox", "", true, false},
+		{"Inbox", testMbox, true, false},
+		{"message.eml", "", false, true},
+		{"1712048400.M1P2.host:2,S", testEmail, false, true},
+		{"notes.txt", "From: me\nSubject: not enough headers\n\nText.\n", false, false},
+		{"notes.txt", "From: me\nDate: today\nJust a sentence, no header.\n\nText.\n", false, false},
+		{"notes.txt", "From here on, plain prose.\n", false, false},
+	}
+	for _, tt := range tests {
+		if got := isMbox(tt.file, []byte(tt.data)); got != tt.mbox {
+			t.Errorf("isMbox(%q) = %v, want %v", tt.file, got, tt.mbox)
+		}
+		if got := isEmail(tt.file, []byte(tt.data)); got != tt.email {
+			t.Errorf("isEmail(%q) = %v, want %v", tt.file, got, tt.email)
+		}
+	}
+}
+
+func TestExtractEmail(t *testing.T) {
+	docs, err := extractEmail("message.eml", []byte(testEmail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []sourceDocument{{
+		Title: "Weekly Notes",
+		Meta: map[string]string{
+			"from":       "Jürgen <news@example.com>",
+			"to":         "me@example.com",
+			"subject":    "Weekly Notes",
+			"message_id": "<1@example.com>",
+			"list_id":    "Weekly <weekly.example.com>",
+			"date":       "2024-04-02T08:00:00Z",
+		},
+		Segments: []sourceSegment{{Text: "# Weekly Notes\n\nThe HTML version is preferred, with a [link](https://example.com/read) and Grüße."}},
+	}}
+	if !reflect.DeepEqual(docs, want) {
+		t.Errorf("extractEmail() = %+v, want %+v", docs, want)
+	}
+}
+
+func TestExtractMbox(t *testing.T) {
+	docs, err := extractMbox("archive.mbox", []byte(testMbox))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []sourceSegment
+	for _, doc := range docs {
+		got = append(got, doc.Segments...)
+	}
+	want := []sourceSegment{
+		{Location: sourceLocation{Unit: "message", Start: "1"}, Text: "# First\n\nHello.\nFrom the archive."},
+		{Location: sourceLocation{Unit: "message", Start: "2"}, Text: "# Untitled message\n\nNo subject here."},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extractMbox() segments = %q, want %q", got, want)
+	}
+	if docs[0].Meta["from"] != "Alice <alice@example.com>" || docs[1].Meta["date"] != "2020-03-04T10:00:00Z" {
+		t.Errorf("extractMbox() metadata = %v, %v", docs[0].Meta, docs[1].Meta)
+	}
+
+	if _, err := extractMbox("empty.mbox", []byte("no messages\n")); err == nil {
+		t.Error("extractMbox() without messages succeeded")
+	}
+}
+
+func TestCollectMaildir(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "Newsletters")
+	for _, name := range []string{"cur/1.eml", "new/2.eml", "tmp/3.eml", "dovecot-uidlist"} {
+		writeTestFile(t, filepath.Join(root, name), testEmail)
+	}
+
+	files, skipped, err := (sourceFilter{}).collect(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, file := range files {
+		rel, _ := filepath.Rel(root, file)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	if want := []string{"cur/1.eml", "new/2.eml"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("collect() of a Maildir = %q, want %q", got, want)
+	}
+	var reasons []string
+	for _, s := range skipped {
+		reasons = append(reasons, filepath.Base(s.Path)+": "+s.Reason)
+	}
+	if want := "dovecot-uidlist: Maildir metadata"; !strings.Contains(strings.Join(reasons, "\n"), want) {
+		t.Errorf("collect() skipped %q, want %q", reasons, want)
+	}
+}
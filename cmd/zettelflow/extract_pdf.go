@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// isPDF detects PDFs by their magic bytes rather than by extension.
+func isPDF(path string, data []byte) bool {
+	return bytes.HasPrefix(data, []byte("%PDF-"))
+}
+
+var (
+	pdfHyphenation = regexp.MustCompile(`(\p{L})-\n(\p{Ll})`)
+	pdfBlankLines  = regexp.MustCompile(`\n{3,}`)
+)
+
+// extractPDF returns the text of every page as its own segment, so that the page
+// numbers survive as locations through chunking and into the ingest output. The PDF
+// reader panics on many kinds of damage; those panics are returned as errors, so that
+// one corrupt file does not stop a directory ingest.
+func extractPDF(path string, data []byte) (docs []sourceDocument, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			docs, err = nil, fmt.Errorf("corrupt file: %v", r)
+		}
+	}()
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	doc := sourceDocument{Title: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			return nil, err
+		}
+		text = cleanPDFText(text)
+		if text == "" {
+			continue
+		}
+		doc.Segments = append(doc.Segments, sourceSegment{
+			Location: sourceLocation{Unit: "page", Start: strconv.Itoa(i)},
+			Text:     text,
+		})
+	}
+	if len(doc.Segments) == 0 {
+		return nil, errors.New("no extractable text (the PDF may be scanned images)")
+	}
+	return []sourceDocument{doc}, nil
+}
+
+// cleanPDFText normalises whitespace and rejoins words hyphenated across line breaks.
+func cleanPDFText(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	text = strings.Join(lines, "\n")
+	text = pdfHyphenation.ReplaceAllString(text, "$1$2")
+	text = pdfBlankLines.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testPDF builds a PDF with one page per text, each shown as lines in Helvetica.
+func testPDF(pages ...[]string) []byte {
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	)
+	for i, lines := range pages {
+		var stream strings.Builder
+		stream.WriteString("BT /F1 12 Tf 72 720 Td 14 TL\n")
+		for _, line := range lines {
+			fmt.Fprintf(&stream, "(%s) Tj T*\n", line)
+		}
+		stream.WriteString("ET")
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", stream.Len(), stream.String()),
+		)
+	}
+
+	var out strings.Builder
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return []byte(out.String())
+}
+
+func TestIsPDF(t *testing.T) {
+	tests := []struct {
+		file, data string
+		want       bool
+	}{
+		{"paper.pdf", "%PDF-1.7\n", true},
+		{"download", "%PDF-1.4\n", true},
+		{"paper.pdf", "not a pdf", false},
+	}
+	for _, tt := range tests {
+		if got := isPDF(tt.file, []byte(tt.data)); got != tt.want {
+			t.Errorf("isPDF(%q, %q) = %v, want %v", tt.file, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestExtractPDF(t *testing.T) {
+	data := testPDF([]string{"First page text."}, []string{"Second page text."})
+	docs, err := extractPDF("dir/paper.pdf", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 || docs[0].Title != "paper" {
+		t.Fatalf("extractPDF() = %+v, want one document titled after the file", docs)
+	}
+	var pages, texts []string
+	for _, s := range docs[0].Segments {
+		pages = append(pages, s.Location.String())
+		texts = append(texts, s.Text)
+	}
+	if want := []string{"page 1", "page 2"}; !reflect.DeepEqual(pages, want) {
+		t.Errorf("segment locations = %q, want %q", pages, want)
+	}
+	if !strings.Contains(texts[0], "First page") || !strings.Contains(texts[1], "Second page") {
+		t.Errorf("segment texts = %q, want the text of each page", texts)
+	}
+
+	if _, err := extractPDF("scan.pdf", testPDF([]string{})); err == nil {
+		t.Error("extractPDF() of a PDF without text succeeded")
+	}
+}
+
+func TestExtractPDFDamaged(t *testing.T) {
+	data := testPDF([]string{"First page text."}, []string{"Second page text."})
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"garbage", []byte("%PDF-1.4\ngarbage\n")},
+		{"truncated", data[:len(data)/2]},
+		// The PDF reader panics on a damaged object.
+		{"corrupt object", bytes.Replace(data, []byte("/Type /Pages"), []byte("/Type @Pages"), 1)},
+		{"corrupt page", bytes.Replace(data, []byte("/MediaBox [0 0 612 792]"), []byte("/MediaBox [0 0 612@792]"), 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := extractPDF("broken.pdf", tt.data); err == nil {
+				t.Error("extractPDF() of a damaged PDF succeeded")
+			}
+			_, err := extractDocuments("broken.pdf", tt.data, "")
+			var unreadable sourceError
+			if !errors.As(err, &unreadable) {
+				t.Errorf("extractDocuments() of a damaged PDF = %v, want a sourceError", err)
+			}
+		})
+	}
+}
+
+func TestCleanPDFText(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"spaces", "  many   spaces  \r\nhere ", "many spaces\nhere"},
+		{"hyphenation", "a hyphen-\nated word", "a hyphenated word"},
+		{"proper names", "Jean-\nPaul", "Jean-\nPaul"},
+		{"blank lines", "one\n\n\n\n\ntwo", "one\n\ntwo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanPDFText(tt.text); got != tt.want {
+				t.Errorf("cleanPDFText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// 00:01:02,500 --> 00:01:04,000 (SRT) or 01:02.500 --> 01:04.000 line:90% (WebVTT)
+	cueTiming = regexp.MustCompile(`^\s*((?:\d+:)?\d{1,2}:\d{2}[,.]\d{1,3})\s*-->\s*((?:\d+:)?\d{1,2}:\d{2}[,.]\d{1,3})`)
+	srtStart  = regexp.MustCompile(`^\s*\d+\s*\r?\n\s*(?:\d+:)?\d{1,2}:\d{2}[,.]\d{1,3}\s*-->`)
+	// [00:12:34] Alice: … or 00:12:34 Alice: … in plain-text transcripts.
+	transcriptLine = regexp.MustCompile(`^\[?((?:\d{1,2}:)?\d{1,2}:\d{2})(?:[.,]\d+)?\]?\s+([^:\n]{1,40}?):\s+(.*)$`)
+	voiceTag       = regexp.MustCompile(`<v(?:\.[^ >]*)?\s+([^>]+)>`)
+	cueTag         = regexp.MustCompile(`</?[^>]*>`)
+	// >> Alice:, ALICE: or [Alice]: at the start of a cue.
+	speakerPrefix = regexp.MustCompile(`^(?:>>\s*([^:]{1,30})|-?\s*([A-Z][A-Z0-9 .'-]{0,30})|-?\s*\[([^\]]{1,30})\]):\s+`)
+)
+
+// isSubtitle detects SRT and WebVTT files by extension or by their first cue.
+func isSubtitle(file string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".srt", ".vtt":
+		return true
+	}
+	head := bytes.TrimPrefix(data[:min(len(data), 512)], []byte("\xef\xbb\xbf"))
+	return bytes.HasPrefix(head, []byte("WEBVTT")) || srtStart.Match(head)
+}
+
+// isTranscript detects plain-text transcripts whose lines start with a timestamp and a
+// speaker, as exported by most meeting and podcast tools.
+func isTranscript(file string, data []byte) bool {
+	lines, matched := 0, 0
+	for _, line := range strings.Split(string(data[:min(len(data), 4096)]), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lines++
+		if transcriptLine.MatchString(line) {
+			matched++
+		}
+		if lines == 20 {
+			break
+		}
+	}
+	return matched >= 3 && matched*2 >= lines
+}
+
+// subtitleCue is one timed piece of a recording's text.
+type subtitleCue struct {
+	Start   time.Duration
+	End     time.Duration
+	Speaker string
+	Text    string
+}
+
+// extractSubtitles turns SRT and WebVTT cues into paragraphs of running text located by
+// the time range they cover in the recording.
+func extractSubtitles(file string, data []byte) ([]sourceDocument, error) {
+	cues := parseCues(decodeText(data))
+	if len(cues) == 0 {
+		return nil, errors.New("no subtitle cues found")
+	}
+	return []sourceDocument{transcriptDocument(file, cues)}, nil
+}
+
+// extractTranscript reads a speaker-tagged transcript. Lines without a timestamp continue
+// the previous speaker's turn.
+func extractTranscript(file string, data []byte) ([]sourceDocument, error) {
+	var cues []subtitleCue
+	for _, line := range strings.Split(decodeText(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if m := transcriptLine.FindStringSubmatch(line); m != nil {
+			start, _ := parseCueTime(m[1])
+			cues = append(cues, subtitleCue{Start: start, End: start, Speaker: strings.TrimSpace(m[2]), Text: m[3]})
+		} else if len(cues) > 0 {
+			cues[len(cues)-1].Text += " " + line
+		}
+	}
+	if len(cues) == 0 {
+		return nil, errors.New("no transcript lines found")
+	}
+	// A turn lasts until the next one starts.
+	for i := 0; i+1 < len(cues); i++ {
+		cues[i].End = cues[i+1].Start
+	}
+	return []sourceDocument{transcriptDocument(file, cues)}, nil
+}
+
+// parseCues reads SRT or WebVTT. Cue numbers, settings, NOTE, STYLE and REGION blocks
+// are dropped, voice tags become speakers, and the repeated lines of rolling captions
+// are removed.
+func parseCues(content string) []subtitleCue {
+	var cues []subtitleCue
+	var previous string
+	for _, block := range strings.Split(content, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		timing := -1
+		for i, line := range lines {
+			if cueTiming.MatchString(line) {
+				timing = i
+				break
+			}
+		}
+		if timing == -1 {
+			continue // WEBVTT header, NOTE, STYLE, REGION or stray text
+		}
+		m := cueTiming.FindStringSubmatch(lines[timing])
+		start, err1 := parseCueTime(m[1])
+		end, err2 := parseCueTime(m[2])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		var speaker string
+		var cueLines []string
+		for _, line := range lines[timing+1:] {
+			if v := voiceTag.FindStringSubmatch(line); v != nil {
+				speaker = strings.TrimSpace(v[1])
+			}
+			if line = strings.TrimSpace(unescapeCueText(cueTag.ReplaceAllString(line, ""))); line != "" {
+				cueLines = append(cueLines, line)
+			}
+		}
+		// Rolling captions repeat the last line of the previous cue as their first line.
+		text := cueLines
+		if len(cueLines) > 1 && cueLines[0] == previous {
+			text = cueLines[1:]
+		}
+		if len(cueLines) > 0 {
+			previous = cueLines[len(cueLines)-1]
+		}
+		if len(text) == 0 {
+			continue
+		}
+		joined := strings.Join(text, " ")
+		if speaker == "" {
+			if p := speakerPrefix.FindStringSubmatch(joined); p != nil {
+				speaker = strings.TrimSpace(p[1] + p[2] + p[3])
+				joined = joined[len(p[0]):]
+			}
+		}
+		cues = append(cues, subtitleCue{Start: start, End: end, Speaker: speaker, Text: joined})
+	}
+	return cues
+}
+
+// transcriptDocument merges cues into paragraphs: a paragraph ends when the speaker
+// changes, after a pause of more than two seconds, or once it is long enough and a
+// sentence ends.
+func transcriptDocument(file string, cues []subtitleCue) sourceDocument {
+	doc := sourceDocument{Title: strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))}
+	var para strings.Builder
+	var current subtitleCue
+	flush := func() {
+		if para.Len() == 0 {
+			return
+		}
+		text := para.String()
+		if current.Speaker != "" {
+			text = "**" + current.Speaker + ":** " + text
+		}
+		doc.Segments = append(doc.Segments, sourceSegment{
+			Location: sourceLocation{Unit: "time", Start: formatCueTime(current.Start), End: formatCueTime(current.End)},
+			Text:     text,
+		})
+		para.Reset()
+	}
+
+	const pause = 2 * time.Second
+	const paragraphLength = 600
+	for _, c := range cues {
+		if para.Len() > 0 {
+			speakerChanged := c.Speaker != "" && c.Speaker != current.Speaker
+			longEnough := para.Len() >= paragraphLength && strings.ContainsAny(para.String()[para.Len()-1:], ".?!")
+			if speakerChanged || c.Start-current.End > pause || longEnough {
+				flush()
+			}
+		}
+		if para.Len() == 0 {
+			speaker := current.Speaker
+			if c.Speaker != "" {
+				speaker = c.Speaker
+			}
+			current = subtitleCue{Start: c.Start, Speaker: speaker}
+		} else {
+			para.WriteString(" ")
+		}
+		para.WriteString(c.Text)
+		current.End = max(current.End, c.End)
+	}
+	flush()
+	return doc
+}
+
+// parseCueTime reads hh:mm:ss,mmm, mm:ss.mmm and hh:mm:ss timestamps.
+func parseCueTime(s string) (time.Duration, error) {
+	s = strings.Replace(s, ",", ".", 1)
+	var frac time.Duration
+	if i := strings.IndexByte(s, '.'); i != -1 {
+		ms, err := strconv.Atoi((s[i+1:] + "00")[:3])
+		if err != nil {
+			return 0, err
+		}
+		frac = time.Duration(ms) * time.Millisecond
+		s = s[:i]
+	}
+	var total time.Duration
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		total = total*60 + time.Duration(n)
+	}
+	return total*time.Second + frac, nil
+}
+
+// formatCueTime renders a timestamp as hh:mm:ss, the resolution kept in note locations.
+func formatCueTime(d time.Duration) string {
+	s := int(d / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+// unescapeCueText resolves the few character references allowed in cue text.
+func unescapeCueText(s string) string {
+	return strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&nbsp;", " ", "&lrm;", "", "&rlm;", "").Replace(s)
+}
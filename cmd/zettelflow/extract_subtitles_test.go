@@ -0,0 +1,133 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testSRT = "1\r\n00:00:01,000 --> 00:00:02,500\r\nWelcome to the show.\r\n\r\n" +
+	"2\r\n00:00:02,600 --> 00:00:04,000\r\n>> ALICE: Thanks for &amp; having me.\r\n\r\n" +
+	"3\r\n00:00:10,000 --> 00:00:12,000\r\n<i>After a pause.</i>\r\n"
+
+const testVTT = `WEBVTT
+
+NOTE written by hand
+
+00:01.000 --> 00:03.000 line:90%
+<v Bob>Rolling captions
+repeat lines
+
+00:03.000 --> 00:05.000
+repeat lines
+like this one.
+`
+
+const testTranscript = `[00:00:05] Alice: Let's start.
+[00:00:09] Bob: Agreed, and
+this line continues Bob.
+[00:01:10] Alice: Next topic.
+`
+
+func TestIsSubtitle(t *testing.T) {
+	tests := []struct {
+		file, data string
+		want       bool
+	}{
+		{"talk.srt", "", true},
+		{"talk.VTT", "", true},
+		{"captions", testSRT, true},
+		{"captions", "\xef\xbb\xbf" + testVTT, true},
+		{"notes.txt", "1. First point\n2. Second point\n", false},
+	}
+	for _, tt := range tests {
+		if got := isSubtitle(tt.file, []byte(tt.data)); got != tt.want {
+			t.Errorf("isSubtitle(%q) = %v, want %v", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestIsTranscript(t *testing.T) {
+	tests := []struct {
+		name, data string
+		want       bool
+	}{
+		{"transcript", testTranscript, true},
+		{"plain times", "00:01 Alice: one\n00:02 Bob: two\n00:03 Alice: three\n", true},
+		{"too few lines", "[00:00:05] Alice: Hi.\n[00:00:09] Bob: Hello.\n", false},
+		{"mostly prose", "Meeting notes\n\n[00:00:05] Alice: Hi.\nSome text.\nMore text.\nEven more.\n[00:00:09] Bob: Hello.\n[00:00:12] Alice: Bye.\nDone.\nEnd.\n", false},
+	}
+	for _, tt := range tests {
+		if got := isTranscript("meeting.txt", []byte(tt.data)); got != tt.want {
+			t.Errorf("isTranscript(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtractSubtitles(t *testing.T) {
+	tests := []struct {
+		name, file, data string
+		want             []sourceSegment
+	}{
+		{"srt", "talk.srt", testSRT, []sourceSegment{
+			{Location: sourceLocation{Unit: "time", Start: "00:00:01", End: "00:00:02"}, Text: "Welcome to the show."},
+			{Location: sourceLocation{Unit: "time", Start: "00:00:02", End: "00:00:04"}, Text: "**ALICE:** Thanks for & having me."},
+			{Location: sourceLocation{Unit: "time", Start: "00:00:10", End: "00:00:12"}, Text: "**ALICE:** After a pause."},
+		}},
+		{"vtt", "talk.vtt", testVTT, []sourceSegment{
+			{Location: sourceLocation{Unit: "time", Start: "00:00:01", End: "00:00:05"}, Text: "**Bob:** Rolling captions repeat lines like this one."},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := extractSubtitles(tt.file, []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(docs) != 1 || docs[0].Title != "talk" {
+				t.Fatalf("extractSubtitles() = %+v, want one document titled after the file", docs)
+			}
+			if !reflect.DeepEqual(docs[0].Segments, tt.want) {
+				t.Errorf("Segments = %q, want %q", docs[0].Segments, tt.want)
+			}
+		})
+	}
+
+	if _, err := extractSubtitles("empty.vtt", []byte("WEBVTT\n")); err == nil {
+		t.Error("extractSubtitles() without cues succeeded")
+	}
+}
+
+func TestExtractTranscript(t *testing.T) {
+	docs, err := extractTranscript("meeting.txt", []byte(testTranscript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []sourceSegment{
+		{Location: sourceLocation{Unit: "time", Start: "00:00:05", End: "00:00:09"}, Text: "**Alice:** Let's start."},
+		{Location: sourceLocation{Unit: "time", Start: "00:00:09", End: "00:01:10"}, Text: "**Bob:** Agreed, and this line continues Bob."},
+		{Location: sourceLocation{Unit: "time", Start: "00:01:10", End: "00:01:10"}, Text: "**Alice:** Next topic."},
+	}
+	if !reflect.DeepEqual(docs[0].Segments, want) {
+		t.Errorf("Segments = %q, want %q", docs[0].Segments, want)
+	}
+}
+
+func TestParseCueTime(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+	}{
+		{"00:01:02,500", time.Minute + 2500*time.Millisecond},
+		{"01:02.5", time.Minute + 2500*time.Millisecond},
+		{"1:00:00", time.Hour},
+	}
+	for _, tt := range tests {
+		if got, err := parseCueTime(tt.s); err != nil || got != tt.want {
+			t.Errorf("parseCueTime(%q) = %v, %v, want %v", tt.s, got, err, tt.want)
+		}
+	}
+	if _, err := parseCueTime("aa:bb"); err == nil {
+		t.Error("parseCueTime() of an invalid timestamp succeeded")
+	}
+}
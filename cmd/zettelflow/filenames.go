@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/spf13/viper"
+)
+
+// namingSchemes are the accepted values of naming.scheme.
+var namingSchemes = []string{"timestamp", "ulid", "zettel", "slug", "hash"}
+
+// fileNamer chooses the names of the files written by ingest and split.
+//
+//	timestamp  ingest_20240501093012.txt, note_20240501093012_3.md (the original names)
+//	ulid       ingest_01HWX3….txt, 01HWX3….md (sortable, unique per call)
+//	zettel     ingest_202405010930.txt, 202405010930.md (Zettelkasten IDs, minute resolution)
+//	slug       ingest_<source-title>.txt, <note-title>.md
+//	hash       ingest_<sha256 prefix>.txt, <sha256 prefix>.md
+//
+// Names are only proposals: createExclusive asks for the next candidate when a name is taken.
+type fileNamer struct {
+	scheme string
+}
+
+// newFileNamer reads naming.scheme from the configuration.
+func newFileNamer() (fileNamer, error) {
+	scheme := strings.ToLower(viper.GetString("naming.scheme"))
+	for _, s := range namingSchemes {
+		if s == scheme {
+			return fileNamer{scheme: scheme}, nil
+		}
+	}
+	return fileNamer{}, fmt.Errorf("unknown naming.scheme %q (expected one of %s)", scheme, strings.Join(namingSchemes, ", "))
+}
+
+// fileName describes the file to be named. Kind is "ingest", "note" or "structure" (the
+// structure note of a source); Index is the
+// position of a note within its ingest output.
+type fileName struct {
+	Kind    string
+	Index   int
+	Title   string
+	Content []byte
+	Time    time.Time
+}
+
+// candidate returns the attempt-th name for f, without extension. Attempt 0 is the
+// preferred name; later attempts resolve collisions in the manner of each scheme.
+func (n fileNamer) candidate(f fileName, attempt int) string {
+	var id string
+	switch n.scheme {
+	case "ulid":
+		id = newULID(f.Time)
+	case "zettel":
+		// Zettelkasten IDs stay IDs: a taken minute moves on to the next free one.
+		id = f.Time.Add(time.Duration(attempt) * time.Minute).Format("200601021504")
+	case "slug":
+		id = slugify(f.Title, 60)
+		if id == "" {
+			id = f.Time.Format("20060102150405")
+		}
+	case "hash":
+		sum := sha256.Sum256(f.Content)
+		id = hex.EncodeToString(sum[:6])
+	default:
+		id = f.Time.Format("20060102150405")
+		if f.Kind == "note" {
+			id = fmt.Sprintf("note_%s_%d", id, f.Index)
+		} else if f.Kind == "structure" {
+			id = "structure_" + id
+		}
+	}
+	if f.Kind == "ingest" {
+		id = "ingest_" + id
+	}
+	if attempt > 0 && n.scheme != "ulid" && n.scheme != "zettel" {
+		id = fmt.Sprintf("%s-%d", id, attempt+1)
+	}
+	return id
+}
+
+// maxNameAttempts bounds the search for a free name.
+const maxNameAttempts = 1000
+
+// createExclusive writes data to a new file in dir named by n, never replacing an
+// existing file. The content is written to a temporary file first and then linked into
+// place, so the final name either does not exist or holds the complete content.
+func createExclusive(dir, ext string, n fileNamer, f fileName, data []byte) (string, error) {
+	tmp, err := writeTemp(dir, data)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp)
+
+	for attempt := 0; attempt < maxNameAttempts; attempt++ {
+		path := filepath.Join(dir, n.candidate(f, attempt)+ext)
+		err := linkNew(tmp, path, data)
+		if err == nil {
+			return path, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no free file name in %s after %d attempts", dir, maxNameAttempts)
+}
+
+// nameReserver picks names that are free in all of dirs, as createExclusive would,
+// without writing anything, so that notes can refer to each other before they exist.
+// Later files step around the names given to earlier ones.
+type nameReserver struct {
+	ext   string
+	namer fileNamer
+	dirs  []string
+	taken map[string]bool
+}
+
+func newNameReserver(ext string, n fileNamer, dirs ...string) *nameReserver {
+	return &nameReserver{ext: ext, namer: n, dirs: dirs, taken: map[string]bool{}}
+}
+
+// reserve returns a free name, without extension, for f.
+func (r *nameReserver) reserve(f fileName) (string, error) {
+	for attempt := 0; attempt < maxNameAttempts; attempt++ {
+		name := r.namer.candidate(f, attempt)
+		free, err := nameFree(name+r.ext, r.dirs)
+		if err != nil {
+			return "", err
+		}
+		if free && !r.taken[name] {
+			r.taken[name] = true
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no free file name in %s after %d attempts", strings.Join(r.dirs, ", "), maxNameAttempts)
+}
+
+func nameFree(name string, dirs []string) (bool, error) {
+	for _, dir := range dirs {
+		if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+			return false, nil
+		} else if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// createReserved writes data to a file under a name chosen by a nameReserver, with the
+// guarantees of createExclusive. It fails if the name was taken in the meantime.
+func createReserved(dir, name, ext string, data []byte) (string, error) {
+	tmp, err := writeTemp(dir, data)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp)
+
+	path := filepath.Join(dir, name+ext)
+	if err := linkNew(tmp, path, data); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return "", fmt.Errorf("%s was created by another process while splitting", path)
+		}
+		return "", err
+	}
+	return path, nil
+}
+
+// writeTemp writes data to a new temporary file in dir and returns its path.
+func writeTemp(dir string, data []byte) (string, error) {
+	tmp, err := os.CreateTemp(dir, ".zettelflow-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// linkNew links the temporary file tmp to path, failing with os.ErrExist if path
+// exists. Filesystems without hard links get an exclusive create of data instead.
+func linkNew(tmp, path string, data []byte) error {
+	err := os.Link(tmp, path)
+	if err == nil || errors.Is(err, os.ErrExist) {
+		return err
+	}
+	return writeNewFile(path, data)
+}
+
+// writeNewFile creates path with O_EXCL and writes data to it.
+func writeNewFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	return file.Close()
+}
+
+// writeFileAtomic replaces path with data via a temporary file and a rename, so readers
+// never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".zettelflow-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// slugify lowercases s and joins its words with hyphens, cut to at most max bytes at a
+// word boundary.
+func slugify(s string, max int) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	slug := strings.Join(words, "-")
+	if len(slug) > max {
+		slug = slug[:max]
+		if cut := strings.LastIndex(slug, "-"); cut > 0 {
+			slug = slug[:cut]
+		}
+		slug = strings.ToValidUTF8(slug, "")
+	}
+	return slug
+}
+
+// crockford is the base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var ulidState struct {
+	sync.Mutex
+	ms      uint64
+	entropy [10]byte
+}
+
+// newULID returns a ULID for t: 48 bits of milliseconds and 80 random bits. IDs made
+// within the same millisecond increment the random part, so they stay sortable.
+func newULID(t time.Time) string {
+	ulidState.Lock()
+	defer ulidState.Unlock()
+
+	ms := uint64(t.UnixMilli())
+	if ms <= ulidState.ms {
+		ms = ulidState.ms
+		for i := len(ulidState.entropy) - 1; i >= 0; i-- {
+			ulidState.entropy[i]++
+			if ulidState.entropy[i] != 0 {
+				break
+			}
+		}
+	} else {
+		ulidState.ms = ms
+		if _, err := rand.Read(ulidState.entropy[:]); err != nil {
+			panic(err)
+		}
+	}
+
+	var raw [16]byte
+	binary.BigEndian.PutUint16(raw[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(raw[2:6], uint32(ms))
+	copy(raw[6:], ulidState.entropy[:])
+
+	// 128 bits encode to 26 characters; the first carries only the top 3 bits.
+	var out [26]byte
+	hi := binary.BigEndian.Uint64(raw[0:8])
+	lo := binary.BigEndian.Uint64(raw[8:16])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewULID(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 30, 12, 0, time.UTC)
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, newULID(now))
+	}
+	for _, id := range ids {
+		if len(id) != 26 || strings.Trim(id, crockford) != "" {
+			t.Fatalf("newULID() = %q, want 26 characters of %s", id, crockford)
+		}
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Errorf("newULID() within one millisecond = %q, want increasing IDs", ids)
+	}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			t.Errorf("newULID() returned %q twice", id)
+		}
+		seen[id] = true
+	}
+	if later := newULID(now.Add(time.Hour)); later[:10] <= ids[0][:10] {
+		t.Errorf("newULID() an hour later = %q, want a later time part than %q", later, ids[0])
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name, s string
+		max     int
+		want    string
+	}{
+		{"words", "How to Take Smart Notes!", 60, "how-to-take-smart-notes"},
+		{"unicode", "Grüße aus Köln – 東京", 60, "grüße-aus-köln-東京"},
+		{"empty", "", 60, ""},
+		{"punctuation only", "?!…", 60, ""},
+		{"word boundary", "alpha beta gamma", 12, "alpha-beta"},
+		{"long word", "abcdefghijklmnop", 10, "abcdefghij"},
+		{"multi-byte cut", "ééééé", 5, "éé"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slugify(tt.s, tt.max); got != tt.want {
+				t.Errorf("slugify(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileNamerCandidate(t *testing.T) {
+	f := fileName{Kind: "note", Index: 3, Title: "Smart Notes", Content: []byte("text"), Time: time.Date(2024, 5, 1, 9, 30, 12, 0, time.UTC)}
+	tests := []struct {
+		scheme  string
+		kind    string
+		attempt int
+		want    string
+	}{
+		{"timestamp", "note", 0, "note_20240501093012_3"},
+		{"timestamp", "note", 1, "note_20240501093012_3-2"},
+		{"timestamp", "ingest", 0, "ingest_20240501093012"},
+		{"timestamp", "structure", 2, "structure_20240501093012-3"},
+		{"zettel", "note", 0, "202405010930"},
+		{"zettel", "note", 2, "202405010932"},
+		{"slug", "note", 0, "smart-notes"},
+		{"slug", "ingest", 1, "ingest_smart-notes-2"},
+		{"hash", "note", 0, "982d9e3eb996"},
+		{"hash", "note", 1, "982d9e3eb996-2"},
+	}
+	for _, tt := range tests {
+		f.Kind = tt.kind
+		if got := (fileNamer{scheme: tt.scheme}).candidate(f, tt.attempt); got != tt.want {
+			t.Errorf("%s candidate(%s, %d) = %q, want %q", tt.scheme, tt.kind, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestCreateExclusive(t *testing.T) {
+	dir := t.TempDir()
+	namer := fileNamer{scheme: "slug"}
+	f := fileName{Kind: "note", Title: "Same Title", Time: time.Now()}
+	writeTestFile(t, filepath.Join(dir, "same-title.md"), "existing")
+
+	var paths []string
+	for _, content := range []string{"first", "second"} {
+		path, err := createExclusive(dir, ".md", namer, f, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, filepath.Base(path))
+	}
+	if want := []string{"same-title-2.md", "same-title-3.md"}; strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("createExclusive() = %q, want %q", paths, want)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "same-title.md")); string(data) != "existing" {
+		t.Errorf("createExclusive() replaced an existing file with %q", data)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".zettelflow-*")); len(leftovers) > 0 {
+		t.Errorf("createExclusive() left temporary files %q", leftovers)
+	}
+}
+
+func TestNameReserver(t *testing.T) {
+	split, enrich := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(enrich, "idea.md"), "enriched earlier")
+	r := newNameReserver(".md", fileNamer{scheme: "slug"}, split, enrich)
+	f := fileName{Kind: "note", Title: "Idea", Time: time.Now()}
+
+	var names []string
+	for i := 0; i < 2; i++ {
+		name, err := r.reserve(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if want := "idea-2 idea-3"; strings.Join(names, " ") != want {
+		t.Errorf("reserve() = %q, want %q", names, want)
+	}
+
+	if _, err := createReserved(split, "idea-2", ".md", []byte("note")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createReserved(split, "idea-2", ".md", []byte("again")); err == nil || !strings.Contains(err.Error(), "another process") {
+		t.Errorf("createReserved() of a taken name = %v, want an error", err)
+	}
+}
+
+func TestLinkNew(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.tmp") // linking it fails, as without hard links
+	taken := filepath.Join(dir, "taken.md")
+	writeTestFile(t, taken, "existing")
+	tests := []struct {
+		name, path string
+		wantErr    error
+		want       string
+	}{
+		{"fallback", filepath.Join(dir, "new.md"), nil, "data"},
+		{"fallback onto existing", taken, os.ErrExist, "existing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := linkNew(missing, tt.path, []byte("data"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("linkNew() = %v, want %v", err, tt.wantErr)
+			}
+			if data, _ := os.ReadFile(tt.path); string(data) != tt.want {
+				t.Errorf("%s holds %q, want %q", tt.path, data, tt.want)
+			}
+		})
+	}
+	if err := linkNew(missing, filepath.Join(dir, "no-such-dir", "x.md"), []byte("data")); err == nil {
+		t.Error("linkNew() into a missing directory succeeded")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+// folgezettelNumbers are the numbers given to sources by split.ids: folgezettel, by
+// content hash, so that splitting the same text again reuses its number. They are kept
+// in paths.folgezettel rather than in the ingest manifest, so that clearing the manifest
+// to ingest everything again does not renumber the sources.
+type folgezettelNumbers struct {
+	path    string
+	Numbers map[string]int `json:"numbers"`
+}
+
+// loadFolgezettelNumbers reads paths.folgezettel. A missing file has no numbers yet.
+func loadFolgezettelNumbers() (*folgezettelNumbers, error) {
+	f := &folgezettelNumbers{path: expandPath(viper.GetString("paths.folgezettel")), Numbers: map[string]int{}}
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("reading Folgezettel numbers %s: %w", f.path, err)
+	}
+	if f.Numbers == nil {
+		f.Numbers = map[string]int{}
+	}
+	return f, nil
+}
+
+// number returns the Folgezettel number of the source with the given hash, giving it
+// the next free number, from split.folgezettel_start, if it has none yet. Unless record
+// is set, a new number is only proposed, not saved.
+func (f *folgezettelNumbers) number(hash string, record bool) (int, error) {
+	if n, ok := f.Numbers[hash]; ok {
+		return n, nil
+	}
+	next := viper.GetInt("split.folgezettel_start")
+	for _, n := range f.Numbers {
+		if n >= next {
+			next = n + 1
+		}
+	}
+	if !record {
+		return next, nil
+	}
+	f.Numbers[hash] = next
+	return next, f.save()
+}
+
+func (f *folgezettelNumbers) save() error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(f.path, append(data, '\n'))
+}
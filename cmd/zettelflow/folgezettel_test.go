@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestFolgezettelNumbers(t *testing.T) {
+	dir := testConfig(t)
+	viper.Set("split.folgezettel_start", 10)
+	steps := []struct {
+		hash   string
+		record bool
+		want   int
+	}{
+		{"a", false, 10},
+		{"a", true, 10},
+		{"b", false, 11},
+		{"a", true, 10},
+		{"b", true, 11},
+		{"c", true, 12},
+	}
+	for _, step := range steps {
+		numbers, err := loadFolgezettelNumbers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := numbers.number(step.hash, step.record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != step.want {
+			t.Errorf("number(%q, %v) = %d, want %d", step.hash, step.record, got, step.want)
+		}
+	}
+
+	// The numbers are kept apart from the ingest manifest, which can be cleared.
+	if _, err := os.Stat(filepath.Join(dir, "manifest.json")); !os.IsNotExist(err) {
+		t.Errorf("numbering wrote the ingest manifest: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "folgezettel.json")); err != nil {
+		t.Errorf("numbering did not write paths.folgezettel: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// splitFrontmatter separates a leading YAML frontmatter block from the body of a note.
+// If the content has no frontmatter, the whole content is returned as the body.
+func splitFrontmatter(content string) (frontmatter, body string) {
+	separator := "\n---\n"
+	if strings.HasPrefix(content, "---") {
+		end := strings.Index(content[3:], separator)
+		if end != -1 {
+			end += 3
+			return strings.TrimSpace(content[3:end]), content[end+len(separator):]
+		}
+	}
+	return "", content
+}
+
+// splitIngestHeader separates the source header that ingest writes in front of its output.
+// Frontmatter without any source* field is left alone, because LLM responses may begin
+// with a --- rule of their own.
+func splitIngestHeader(content string) (header *yaml.Node, body string) {
+	frontmatter, rest := splitFrontmatter(content)
+	if frontmatter == "" {
+		return nil, content
+	}
+	fields, err := parseFrontmatter(frontmatter)
+	if err != nil {
+		return nil, content
+	}
+	for i := 0; i < len(fields.Content); i += 2 {
+		if strings.HasPrefix(fields.Content[i].Value, "source") {
+			return fields, rest
+		}
+	}
+	return nil, content
+}
+
+// readIngestHeader reads the source header that ingest writes in front of its output
+// from the start of r, like splitIngestHeader, and returns it with a reader of the rest.
+// Only the frontmatter is read ahead, so the body can be streamed.
+func readIngestHeader(r *bufio.Reader) (*yaml.Node, io.Reader, error) {
+	var head strings.Builder
+	for lines := 0; ; lines++ {
+		line, err := r.ReadString('\n')
+		head.WriteString(line)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if lines == 0 && !strings.HasPrefix(line, "---") {
+			break
+		}
+		if (lines > 0 && line == "---\n") || head.Len() > maxHeaderSize {
+			break
+		}
+	}
+	header, rest := splitIngestHeader(head.String())
+	return header, io.MultiReader(strings.NewReader(rest), r), nil
+}
+
+// maxHeaderSize bounds how much of a file readIngestHeader reads looking for the end of
+// the header; ingest headers are a few hundred bytes.
+const maxHeaderSize = 64 * 1024
+
+// parseFrontmatter decodes frontmatter into a YAML mapping node, keeping key order
+// so that rewritten frontmatter keeps the shape of the template it came from.
+func parseFrontmatter(frontmatter string) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(frontmatter), &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	return doc.Content[0], nil
+}
+
+// frontmatterField returns the value node stored under key, or nil.
+func frontmatterField(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setFrontmatterField replaces the value stored under key, appending the key if it is missing.
+func setFrontmatterField(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		value,
+	)
+}
+
+// stringNode builds a plain YAML string scalar.
+func stringNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// stringListNode builds a flow-style YAML sequence, matching the `tags: [a, b]` style of note_header.yml.
+func stringListNode(values []string) *yaml.Node {
+	seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle}
+	for _, v := range values {
+		seq.Content = append(seq.Content, stringNode(v))
+	}
+	return seq
+}
+
+// marshalFrontmatter encodes a mapping node back into frontmatter text without the --- fences.
+func marshalFrontmatter(mapping *yaml.Node) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(mapping); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
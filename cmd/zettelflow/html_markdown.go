@@ -0,0 +1,263 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlToMarkdown renders an HTML node tree as Markdown. Only the structure that matters
+// for notes is kept: headings, paragraphs, emphasis, links, code, lists, quotes and tables.
+func htmlToMarkdown(n *html.Node) string {
+	return normaliseMarkdown(renderBlock(n))
+}
+
+// parseHTMLFragment parses a complete or partial HTML document.
+func parseHTMLFragment(src string) (*html.Node, error) {
+	return html.Parse(strings.NewReader(src))
+}
+
+var inlineWhitespace = regexp.MustCompile(`\s+`)
+
+// renderBlock renders a node and its children. Block elements are surrounded by blank
+// lines, which normaliseMarkdown later collapses.
+func renderBlock(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return inlineWhitespace.ReplaceAllString(n.Data, " ")
+	case html.DocumentNode:
+		return renderChildren(n)
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Noscript, atom.Template, atom.Svg,
+		atom.Iframe, atom.Form, atom.Button, atom.Input, atom.Select, atom.Textarea:
+		return ""
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		text := strings.TrimSpace(inlineWhitespace.ReplaceAllString(renderChildren(n), " "))
+		if text == "" {
+			return ""
+		}
+		return "\n\n" + strings.Repeat("#", level) + " " + text + "\n\n"
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Header, atom.Footer,
+		atom.Aside, atom.Figure, atom.Figcaption, atom.Nav, atom.Dl, atom.Dt, atom.Dd:
+		return "\n\n" + strings.TrimSpace(renderChildren(n)) + "\n\n"
+	case atom.Br:
+		return "\n"
+	case atom.Hr:
+		return "\n\n---\n\n"
+	case atom.Strong, atom.B:
+		return wrapInline(renderChildren(n), "**")
+	case atom.Em, atom.I:
+		return wrapInline(renderChildren(n), "*")
+	case atom.Del, atom.S:
+		return wrapInline(renderChildren(n), "~~")
+	case atom.Code, atom.Kbd, atom.Samp:
+		text := textContent(n)
+		if strings.Contains(text, "`") {
+			return "`` " + text + " ``"
+		}
+		return wrapInline(text, "`")
+	case atom.Pre:
+		return "\n\n```" + codeLanguage(n) + "\n" + strings.TrimRight(textContent(n), "\n") + "\n```\n\n"
+	case atom.A:
+		text := strings.TrimSpace(renderChildren(n))
+		href := attr(n, "href")
+		if text == "" || href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") {
+			return renderChildren(n)
+		}
+		return "[" + text + "](" + href + ")"
+	case atom.Img:
+		if src := attr(n, "src"); src != "" {
+			return "![" + attr(n, "alt") + "](" + src + ")"
+		}
+		return ""
+	case atom.Ul, atom.Ol:
+		if n.Parent != nil && n.Parent.DataAtom == atom.Li {
+			// Nested lists stay tight against their parent item.
+			return "\n" + renderList(n) + "\n"
+		}
+		return "\n\n" + renderList(n) + "\n\n"
+	case atom.Blockquote:
+		inner := normaliseMarkdown(renderChildren(n))
+		lines := strings.Split(inner, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		return "\n\n" + strings.Join(lines, "\n") + "\n\n"
+	case atom.Table:
+		return "\n\n" + renderTable(n) + "\n\n"
+	}
+	return renderChildren(n)
+}
+
+func renderChildren(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(renderBlock(c))
+	}
+	return b.String()
+}
+
+// wrapInline surrounds text with a Markdown marker, keeping surrounding spaces outside it.
+func wrapInline(text, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	lead := text[:len(text)-len(strings.TrimLeft(text, " "))]
+	trail := text[len(strings.TrimRight(text, " ")):]
+	return lead + marker + trimmed + marker + trail
+}
+
+// renderList renders ul/ol items, indenting nested content under each bullet.
+func renderList(n *html.Node) string {
+	var items []string
+	index := 1
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.DataAtom != atom.Li {
+			continue
+		}
+		bullet := "- "
+		if n.DataAtom == atom.Ol {
+			bullet = strconv.Itoa(index) + ". "
+			index++
+		}
+		body := normaliseMarkdown(renderChildren(c))
+		lines := strings.Split(body, "\n")
+		for i := 1; i < len(lines); i++ {
+			if lines[i] != "" {
+				lines[i] = strings.Repeat(" ", len(bullet)) + lines[i]
+			}
+		}
+		items = append(items, bullet+strings.Join(lines, "\n"))
+	}
+	return strings.Join(items, "\n")
+}
+
+// renderTable renders a table as a GitHub-flavoured Markdown table, treating the first row as the header.
+func renderTable(n *html.Node) string {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if c.DataAtom == atom.Tr {
+				var cells []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+						text := strings.TrimSpace(inlineWhitespace.ReplaceAllString(renderChildren(cell), " "))
+						cells = append(cells, strings.ReplaceAll(text, "|", `\|`))
+					}
+				}
+				rows = append(rows, cells)
+				continue
+			}
+			walk(c)
+		}
+	}
+	walk(n)
+	return markdownTable(rows)
+}
+
+// codeLanguage reads a language-xxx class from a pre element or its code child.
+func codeLanguage(pre *html.Node) string {
+	for _, n := range []*html.Node{pre, pre.FirstChild} {
+		if n == nil || n.Type != html.ElementNode {
+			continue
+		}
+		for _, class := range strings.Fields(attr(n, "class")) {
+			if lang := strings.TrimPrefix(class, "language-"); lang != class {
+				return lang
+			}
+			if lang := strings.TrimPrefix(class, "lang-"); lang != class {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+// textContent returns the raw text below a node, preserving whitespace.
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.DataAtom == atom.Br {
+			b.WriteString("\n")
+			continue
+		}
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasAttr reports whether n has the attribute, whatever its value. Boolean attributes
+// such as hidden have none.
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// findElement returns the first element below n (in document order) matching the atom.
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// normaliseMarkdown trims trailing whitespace and collapses runs of blank lines,
+// leaving the contents of fenced code blocks untouched.
+func normaliseMarkdown(md string) string {
+	var out []string
+	inFence := false
+	blank := 0
+	for _, line := range strings.Split(md, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		}
+		if !inFence {
+			line = strings.TrimRight(line, " \t")
+		}
+		if line == "" && !inFence {
+			blank++
+			if blank > 1 {
+				continue
+			}
+		} else {
+			blank = 0
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
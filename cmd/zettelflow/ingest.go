@@ -3,16 +3,18 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
-	openai "github.com/sashabaranov/go-openai"
 	"github.com/pterm/pterm"
+	openai "github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -23,7 +25,9 @@ var ingestCmd = &cobra.Command{
 	Long:  `Reads input from a file, a directory, or stdin, injects it into a prompt, and calls an OpenAI-compatible API.`,
 	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		checkAPIKey()
+		if raw, _ := cmd.Flags().GetBool("raw"); !raw {
+			checkAPIKey()
+		}
 		pterm.DefaultBox.WithTitle("Ingest Stage").Println("Starting ingestion process...")
 
 		// Print settings
@@ -36,47 +40,63 @@ var ingestCmd = &cobra.Command{
 		pterm.DefaultTree.WithRoot(pterm.NewTreeFromLeveledList(leveledList)).Render()
 		pterm.Println() // for spacing
 
+		manifest, err := loadManifest()
+		cobra.CheckErr(err)
+
 		// Case 1: Path argument is provided (file or directory)
 		if len(args) > 0 {
 			path := args[0]
 			info, err := os.Stat(path)
 			cobra.CheckErr(err)
 
+			filter, err := newSourceFilter(cmd)
+			cobra.CheckErr(err)
 			if info.IsDir() {
 				// Process a directory
-				pterm.Info.Printf("Ingesting all files in directory: %s\n", path)
-				files, err := ioutil.ReadDir(path)
+				pterm.Info.Printf("Ingesting files in directory: %s\n", path)
+				files, skipped, err := filter.collect(path)
 				cobra.CheckErr(err)
-				for _, file := range files {
-					if !file.IsDir() {
-						filePath := filepath.Join(path, file.Name())
-						pterm.Debug.Printf("  - Processing file: %s\n", filePath)
-						content, err := ioutil.ReadFile(filePath)
-						cobra.CheckErr(err)
-						processAndSave(string(content), cmd)
+				processed := 0
+				for _, filePath := range files {
+					pterm.Debug.Printf("  - Processing file: %s\n", filePath)
+					reason, err := ingestFile(filePath, manifest, cmd)
+					var unreadable sourceError
+					if errors.As(err, &unreadable) {
+						skipped = append(skipped, skippedSource{Path: filePath, Reason: err.Error()})
+						continue
 					}
+					cobra.CheckErr(err)
+					if reason != "" {
+						skipped = append(skipped, skippedSource{Path: filePath, Reason: reason})
+						continue
+					}
+					processed++
 				}
+				printSourceSummary(processed, skipped)
 			} else {
 				// Process a single file
+				if reason := filter.check(path, info); reason != "" {
+					pterm.Warning.Printf("Skipping %s: %s\n", path, reason)
+					os.Exit(0)
+				}
 				pterm.Info.Printf("Ingesting file: %s\n", path)
-				content, err := ioutil.ReadFile(path)
+				reason, err := ingestFile(path, manifest, cmd)
 				cobra.CheckErr(err)
-				processAndSave(string(content), cmd)
+				if reason != "" {
+					pterm.Warning.Printf("Skipping %s: %s\n", path, reason)
+					os.Exit(0)
+				}
 			}
 		} else {
 			// Case 2 & 3: No path, check for piped input or start interactive mode
 			stat, _ := os.Stdin.Stat()
 			var inputText string
 			if (stat.Mode() & os.ModeCharDevice) == 0 {
-				// Piped input
+				// Piped input, read whole: exports such as conversations.json are a single long line.
 				pterm.Info.Println("Ingesting from stdin...")
-				scanner := bufio.NewScanner(os.Stdin)
-				var builder strings.Builder
-				for scanner.Scan() {
-					builder.WriteString(scanner.Text())
-					builder.WriteString("\n")
-				}
-				inputText = builder.String()
+				data, err := io.ReadAll(os.Stdin)
+				cobra.CheckErr(err)
+				inputText = strings.ReplaceAll(string(data), "\r\n", "\n")
 			} else {
 				// Interactive prompt
 				pterm.Info.Println("Enter text to ingest. Press Enter for a new line.")
@@ -93,48 +113,369 @@ var ingestCmd = &cobra.Command{
 					os.Exit(0)
 				}
 			}
-			processAndSave(inputText, cmd)
+			origin := sourceOrigin{Path: "stdin", Hash: hashContent([]byte(inputText))}
+			if reason := manifestSkipReason(manifest, origin, cmd); reason != "" {
+				pterm.Warning.Printf("Skipping stdin: %s\n", reason)
+				os.Exit(0)
+			}
+			// Piped text is plain unless a format is named, e.g. --format kindle.
+			docs := []sourceDocument{plainDocument(inputText)}
+			if format, _ := cmd.Flags().GetString("format"); format != "auto" {
+				docs, err = extractDocuments(origin.Path, []byte(inputText), format)
+				cobra.CheckErr(err)
+			}
+			docs, err = selectDocuments(docs, cmd)
+			cobra.CheckErr(err)
+			if len(docs) == 0 {
+				pterm.Warning.Println("No documents match the selection (--since, --until, --title, --from, --subject).")
+				os.Exit(0)
+			}
+			docs, reason := newDocuments(manifest, docs, cmd)
+			if reason != "" {
+				pterm.Warning.Printf("Skipping stdin: %s\n", reason)
+				os.Exit(0)
+			}
+			origin.Version = manifest.nextVersion(origin.Path)
+			var outputs []string
+			for _, doc := range docs {
+				outputFile, err := processAndSave(doc, origin, cmd)
+				cobra.CheckErr(err)
+				outputs = append(outputs, outputFile)
+			}
+			cobra.CheckErr(manifest.record(origin, docs, outputs))
 		}
 		pterm.Success.Println("Ingest stage complete.")
 		os.Exit(0)
 	},
 }
 
-// processAndSave contains the core logic for taking text, calling the LLM, and saving the result.
-func processAndSave(inputText string, cmd *cobra.Command) {
+// ingestFile extracts the documents contained in a file and processes each of them.
+// Files whose content is already in the manifest are skipped unless --force is given;
+// the reason is returned. A changed file is ingested again as a new version, made of
+// the documents not ingested before.
+func ingestFile(path string, manifest *ingestManifest, cmd *cobra.Command) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", sourceError{err}
+	}
+	origin := fileOrigin(path, content)
+	if reason := manifestSkipReason(manifest, origin, cmd); reason != "" {
+		return reason, nil
+	}
+	format, _ := cmd.Flags().GetString("format")
+	docs, err := extractDocuments(path, content, format)
+	if err != nil {
+		return "", err
+	}
+	if docs, err = selectDocuments(docs, cmd); err != nil {
+		return "", err
+	}
+	if len(docs) == 0 {
+		return "no documents match the selection", nil
+	}
+	docs, reason := newDocuments(manifest, docs, cmd)
+	if reason != "" {
+		return reason, nil
+	}
+	origin.Version = manifest.nextVersion(origin.Path)
+	var outputs []string
+	for _, doc := range docs {
+		outputFile, err := processAndSave(doc, origin, cmd)
+		if err != nil {
+			return "", err
+		}
+		outputs = append(outputs, outputFile)
+	}
+	return "", manifest.record(origin, docs, outputs)
+}
+
+// sourceError is a problem with one source file, such as a scanned PDF without text or
+// a file in a format that cannot be read. A directory ingest lists the file as skipped
+// and goes on; errors writing outputs or the manifest stop it.
+type sourceError struct {
+	err error
+}
+
+func (e sourceError) Error() string { return e.err.Error() }
+func (e sourceError) Unwrap() error { return e.err }
+
+// manifestSkipReason explains why a source should not be sent to the LLM again, or
+// returns "" if it is new, has changed, or --force is set. Selecting documents with
+// --since, --until, --title, --from or --subject also bypasses the manifest, since
+// another selection from the same source is new work.
+func manifestSkipReason(manifest *ingestManifest, origin sourceOrigin, cmd *cobra.Command) string {
+	if manifestBypassed(cmd) {
+		return ""
+	}
+	previous := manifest.findHash(origin.Hash)
+	if previous == nil {
+		return ""
+	}
+	when := previous.IngestedAt.Local().Format("2006-01-02 15:04")
+	if previous.Source != origin.Path {
+		return fmt.Sprintf("same content as %s, ingested %s (use --force)", previous.Source, when)
+	}
+	return fmt.Sprintf("unchanged since %s (use --force)", when)
+}
+
+// newDocuments drops the documents of a new or changed source that an earlier ingest
+// already sent to the LLM, such as the old messages of a mailbox that has grown. If none
+// are left it returns the reason to skip the source. Like manifestSkipReason, it keeps
+// every document when --force or a selection flag is given.
+func newDocuments(manifest *ingestManifest, docs []sourceDocument, cmd *cobra.Command) ([]sourceDocument, string) {
+	if manifestBypassed(cmd) {
+		return docs, ""
+	}
+	var fresh []sourceDocument
+	var previous *manifestEntry
+	for _, doc := range docs {
+		if e := manifest.findDocument(documentKey(doc)); e != nil {
+			if previous == nil || e.IngestedAt.After(previous.IngestedAt) {
+				previous = e
+			}
+			continue
+		}
+		fresh = append(fresh, doc)
+	}
+	if previous == nil {
+		return docs, ""
+	}
+	when := previous.IngestedAt.Local().Format("2006-01-02 15:04")
+	if len(fresh) == 0 {
+		return nil, fmt.Sprintf("all %d document(s) were ingested before, last on %s (use --force)", len(docs), when)
+	}
+	pterm.Info.Printf("Skipping %d of %d document(s) ingested before.\n", len(docs)-len(fresh), len(docs))
+	return fresh, ""
+}
+
+// manifestBypassed reports whether the manifest is ignored: with --force, or when
+// --since, --until, --title, --from or --subject select documents.
+func manifestBypassed(cmd *cobra.Command) bool {
+	if force, _ := cmd.Flags().GetBool("force"); force {
+		return true
+	}
+	for _, name := range documentSelectFlags {
+		if cmd.Flags().Changed(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// documentDateKeys are the metadata fields that date a document, in order of preference.
+var documentDateKeys = []string{"created", "published", "date"}
+
+// documentSelectFlags are the ingest flags that select documents from a source.
+var documentSelectFlags = []string{"since", "until", "title", "from", "subject"}
+
+// documentMetaFilters map the pattern flags that match metadata (e.g. the headers of
+// an email) to the metadata field they match.
+var documentMetaFilters = map[string]string{"from": "from", "subject": "subject"}
+
+// selectDocuments applies --since, --until, --title, --from and --subject to the
+// documents of a source, e.g. the conversations of a chat export or the messages of a
+// mailbox. Date filters keep documents without a date; pattern filters drop documents
+// without the field they match.
+func selectDocuments(docs []sourceDocument, cmd *cobra.Command) ([]sourceDocument, error) {
+	selecting := false
+	for _, name := range documentSelectFlags {
+		if value, _ := cmd.Flags().GetString(name); value != "" {
+			selecting = true
+		}
+	}
+	if !selecting {
+		return docs, nil
+	}
+	since, _ := cmd.Flags().GetString("since")
+	until, _ := cmd.Flags().GetString("until")
+	title, _ := cmd.Flags().GetString("title")
+
+	var from, to time.Time
+	var err error
+	if since != "" {
+		if from, err = time.ParseInLocation("2006-01-02", since, time.Local); err != nil {
+			return nil, fmt.Errorf("invalid --since date %q (expected YYYY-MM-DD)", since)
+		}
+	}
+	if until != "" {
+		if to, err = time.ParseInLocation("2006-01-02", until, time.Local); err != nil {
+			return nil, fmt.Errorf("invalid --until date %q (expected YYYY-MM-DD)", until)
+		}
+		to = to.AddDate(0, 0, 1) // inclusive
+	}
+	var titlePattern *regexp.Regexp
+	if title != "" {
+		if titlePattern, err = regexp.Compile("(?i)" + title); err != nil {
+			return nil, fmt.Errorf("invalid --title pattern: %w", err)
+		}
+	}
+	metaPatterns := map[string]*regexp.Regexp{}
+	for name, key := range documentMetaFilters {
+		value, _ := cmd.Flags().GetString(name)
+		if value == "" {
+			continue
+		}
+		if metaPatterns[key], err = regexp.Compile("(?i)" + value); err != nil {
+			return nil, fmt.Errorf("invalid --%s pattern: %w", name, err)
+		}
+	}
+
+	var selected []sourceDocument
+	for _, doc := range docs {
+		if titlePattern != nil && !titlePattern.MatchString(doc.Title) {
+			continue
+		}
+		matched := true
+		for key, pattern := range metaPatterns {
+			if !pattern.MatchString(doc.Meta[key]) {
+				matched = false
+			}
+		}
+		if !matched {
+			continue
+		}
+		var date time.Time
+		for _, key := range documentDateKeys {
+			if t, err := time.Parse(time.RFC3339, doc.Meta[key]); err == nil {
+				date = t
+				break
+			}
+		}
+		if !date.IsZero() && ((!from.IsZero() && date.Before(from)) || (!to.IsZero() && !date.Before(to))) {
+			continue
+		}
+		selected = append(selected, doc)
+	}
+	pterm.Info.Printf("Selected %d of %d document(s).\n", len(selected), len(docs))
+	return selected, nil
+}
+
+// processAndSave contains the core logic for taking a document, calling the LLM, and saving the result.
+// Raw sources (--raw or ingest.raw_extensions) skip the LLM and are saved as they are.
+// The saved output starts with a provenance header that split carries into every note.
+// It returns the path of the saved output.
+func processAndSave(doc sourceDocument, origin sourceOrigin, cmd *cobra.Command) (string, error) {
+	var output, promptFile, model string
+	if isRawIngest(origin.Path, cmd) {
+		pterm.Info.Println("Raw ingest: saving the source text without an LLM pass.")
+		output = rawText(doc, viper.GetBool("ingest.raw_cleanup"))
+	} else {
+		var err error
+		output, promptFile, model, err = completeDocument(doc, cmd)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Save the response, preceded by its provenance.
+	now := time.Now()
+	header, err := provenanceHeader(origin, doc, promptFile, model, now)
+	if err != nil {
+		return "", err
+	}
+	saved := fmt.Sprintf("---\n%s\n---\n%s", header, output)
+
+	title := doc.Title
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(origin.Path), filepath.Ext(origin.Path))
+	}
+	namer, err := newFileNamer()
+	if err != nil {
+		return "", err
+	}
+	ingestPath := expandPath(viper.GetString("paths.ingest"))
+	outputFile, err := createExclusive(ingestPath, ".txt", namer, fileName{
+		Kind:    "ingest",
+		Title:   title,
+		Content: []byte(saved),
+		Time:    now,
+	}, []byte(saved))
+	if err != nil {
+		return "", err
+	}
+	pterm.Success.Printf("Saved ingested text to: %s\n", outputFile)
+	return outputFile, nil
+}
+
+// completeDocument sends a document through the ingest prompt. Documents larger than
+// ingest.max_input_chars are sent in several parts. When the source has locations (e.g.
+// PDF pages or transcript paragraphs), the model is asked to keep the location marker of
+// every segment; a part of the response without markers is preceded by the location of
+// the whole part. It returns the response together with the prompt file and model used.
+func completeDocument(doc sourceDocument, cmd *cobra.Command) (string, string, string, error) {
 	model := viper.GetString("ingest.model")
 	if model == "" {
-		pterm.Error.Println("Error: ingest model is not defined in the configuration.")
-		os.Exit(1)
+		return "", "", "", errors.New("ingest model is not defined in the configuration")
 	}
 
 	// If no prompt file is specified, use the default.
 	promptFile, _ := cmd.Flags().GetString("prompt")
 	if promptFile == "" {
-		promptFile = viper.GetString("paths.prompts")
-		// Expand ~
-		if promptFile[0] == '~' {
-			home, err := os.UserHomeDir()
-			cobra.CheckErr(err)
-			promptFile = filepath.Join(home, promptFile[1:])
-		}
-		promptFile = filepath.Join(promptFile, "default_ingest.md")
+		promptFile = filepath.Join(expandPath(viper.GetString("paths.prompts")), "default_ingest.md")
 	}
 
 	promptTemplate, err := ioutil.ReadFile(promptFile)
-	cobra.CheckErr(err)
-
-	finalPrompt := strings.Replace(string(promptTemplate), "{input_text}", inputText, -1)
+	if err != nil {
+		return "", "", "", err
+	}
 
 	client := openai.NewClient(viper.GetString("llm.api_key"))
+	chunks := chunkSegments(doc.Segments, viper.GetInt("ingest.max_input_chars"))
+
+	var output strings.Builder
+	for i, chunk := range chunks {
+		location := segmentsLocation(chunk)
+		if len(chunks) > 1 {
+			if location.Unit != "" {
+				pterm.Info.Printf("Part %d of %d (%s)\n", i+1, len(chunks), location)
+			} else {
+				pterm.Info.Printf("Part %d of %d\n", i+1, len(chunks))
+			}
+		}
+		finalPrompt := ingestPrompt(string(promptTemplate), chunk)
+		response, err := streamCompletion(client, model, finalPrompt)
+		if err != nil {
+			return "", "", "", err
+		}
+
+		if output.Len() > 0 {
+			output.WriteString("\n\n")
+		}
+		if location.Unit != "" && !strings.HasPrefix(strings.TrimSpace(response), "<!-- zettelflow:location ") {
+			output.WriteString(locationMarker(location))
+			output.WriteString("\n")
+		}
+		output.WriteString(response)
+	}
+	return output.String(), promptFile, model, nil
+}
+
+// locationInstruction is added to the ingest prompt when the input holds location markers.
+const locationInstruction = "The text contains HTML comments such as <!-- zettelflow:location page 3 -->. " +
+	"Copy each of them unchanged onto its own line in front of the output that comes from the text following it."
+
+// ingestPrompt fills the prompt template with the segments of one part of a document.
+// Segments with a location are preceded by their location marker, which the model is
+// asked to keep, so that every note can point back to its own page, highlight or moment
+// rather than to the whole part.
+func ingestPrompt(template string, segments []sourceSegment) string {
+	if segmentsLocation(segments).Unit == "" {
+		return strings.Replace(template, "{input_text}", joinSegments(segments), -1)
+	}
+	input := rawText(sourceDocument{Segments: segments}, false)
+	return strings.Replace(template, "{input_text}", input, -1) + "\n\n" + locationInstruction
+}
+
+// streamCompletion sends the prompt to the LLM, echoing the streamed response to the terminal.
+func streamCompletion(client *openai.Client, model, prompt string) (string, error) {
 	req := openai.ChatCompletionRequest{
-		Model:             model,
-		Temperature:       float32(viper.GetFloat64("ingest.temperature")),
+		Model:               model,
+		Temperature:         float32(viper.GetFloat64("ingest.temperature")),
 		MaxCompletionTokens: viper.GetInt("ingest.max_completion_tokens"),
 		Messages: []openai.ChatCompletionMessage{
 			{
 				Role:    openai.ChatMessageRoleUser,
-				Content: finalPrompt,
+				Content: prompt,
 			},
 		},
 		Stream: true,
@@ -142,7 +483,9 @@ func processAndSave(inputText string, cmd *cobra.Command) {
 
 	pterm.Info.Println("Sending request to LLM...")
 	stream, err := client.CreateChatCompletionStream(context.Background(), req)
-	cobra.CheckErr(err)
+	if err != nil {
+		return "", err
+	}
 	defer stream.Close()
 
 	pterm.Println() // Add a newline for better formatting
@@ -154,8 +497,8 @@ func processAndSave(inputText string, cmd *cobra.Command) {
 			break
 		}
 		if err != nil {
-			pterm.Error.Printf("\nStream error: %v\n", err)
-			os.Exit(1)
+			pterm.Println()
+			return "", fmt.Errorf("stream error: %w", err)
 		}
 		if len(response.Choices) > 0 {
 			chunk := response.Choices[0].Delta.Content
@@ -165,25 +508,22 @@ func processAndSave(inputText string, cmd *cobra.Command) {
 	}
 	pterm.Println() // Add a newline for better formatting
 	pterm.DefaultSection.Println("End of Response")
-
-
-	// Save the response
-	ingestPath := viper.GetString("paths.ingest")
-	// Expand ~
-	if ingestPath[0] == '~' {
-		home, err := os.UserHomeDir()
-		cobra.CheckErr(err)
-		ingestPath = filepath.Join(home, ingestPath[1:])
-	}
-
-	ts := time.Now().Format("20060102150405")
-	outputFile := filepath.Join(ingestPath, fmt.Sprintf("ingest_%s.txt", ts))
-	err = ioutil.WriteFile(outputFile, []byte(responseBuilder.String()), 0644)
-	cobra.CheckErr(err)
-	pterm.Success.Printf("Saved ingested text to: %s\n", outputFile)
+	return responseBuilder.String(), nil
 }
 
 func init() {
 	rootCmd.AddCommand(ingestCmd)
 	ingestCmd.Flags().StringP("prompt", "p", "", "Path to a custom prompt file")
+	ingestCmd.Flags().BoolP("recursive", "r", false, "Descend into subdirectories when ingesting a directory")
+	ingestCmd.Flags().StringSlice("include", nil, "Only ingest files matching these globs (e.g. '*.md,notes/**')")
+	ingestCmd.Flags().StringSlice("exclude", nil, "Skip files matching these globs")
+	ingestCmd.Flags().String("format", "auto", "Source format: "+strings.Join(extractorNames(), ", "))
+	ingestCmd.Flags().Bool("raw", false, "Save sources as they are, without an LLM pass (for text that is already ###-delimited)")
+	ingestCmd.Flags().String("since", "", "Only ingest documents (e.g. conversations) created on or after this date (YYYY-MM-DD)")
+	ingestCmd.Flags().String("until", "", "Only ingest documents created on or before this date (YYYY-MM-DD)")
+	ingestCmd.Flags().String("title", "", "Only ingest documents whose title matches this regular expression")
+	ingestCmd.Flags().String("from", "", "Only ingest messages whose sender matches this regular expression")
+	ingestCmd.Flags().String("subject", "", "Only ingest messages whose subject matches this regular expression")
+	ingestCmd.Flags().BoolP("force", "f", false, "Ingest sources and documents again even if the manifest shows them unchanged")
+	ingestCmd.Flags().Int("max-size", 0, "Skip files larger than this many MB (default ingest.max_file_size_mb)")
 }
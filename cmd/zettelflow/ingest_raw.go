@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// isRawIngest reports whether a source bypasses the LLM: with --raw, or when its
+// extension is listed in ingest.raw_extensions.
+func isRawIngest(path string, cmd *cobra.Command) bool {
+	if raw, _ := cmd.Flags().GetBool("raw"); raw {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return false
+	}
+	for _, e := range viper.GetStringSlice("ingest.raw_extensions") {
+		e = strings.ToLower(e)
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeText converts plain text to UTF-8 with \n line endings. UTF-8 and UTF-16 are
+// recognised by their byte order mark; text that is not valid UTF-8 is read as
+// Windows-1252, the usual encoding of older Windows and Kindle files.
+func decodeText(data []byte) string {
+	switch {
+	case hasUTF16BOM(data):
+		if decoded, _, err := transform.Bytes(unicode.BOMOverride(unicode.UTF8.NewDecoder()), data); err == nil {
+			data = decoded
+		}
+	case utf8.Valid(data):
+		data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	default:
+		if decoded, _, err := transform.Bytes(charmap.Windows1252.NewDecoder(), data); err == nil {
+			data = decoded
+		}
+	}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n")
+}
+
+// hasUTF16BOM reports whether data starts with the byte order mark of UTF-16, in either
+// byte order.
+func hasUTF16BOM(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{0xff, 0xfe}) || bytes.HasPrefix(data, []byte{0xfe, 0xff})
+}
+
+// invisibleChars are removed by the raw Markdown cleanup; non-breaking spaces become spaces.
+var invisibleChars = strings.NewReplacer("\u200b", "", "\u200c", "", "\u200d", "", "\u2060", "", "\ufeff", "", "\u00a0", " ")
+
+// rawText writes a document as ingest output without an LLM pass: its segments in order,
+// each preceded by a location marker where the location changes. With cleanup, trailing
+// whitespace, runs of blank lines and invisible characters are removed outside code fences.
+func rawText(doc sourceDocument, cleanup bool) string {
+	var out strings.Builder
+	var last sourceLocation
+	for _, s := range doc.Segments {
+		if out.Len() > 0 {
+			out.WriteString("\n\n")
+		}
+		if s.Location.Unit != "" && s.Location != last {
+			out.WriteString(locationMarker(s.Location))
+			out.WriteString("\n")
+			last = s.Location
+		}
+		out.WriteString(s.Text)
+	}
+	if !cleanup {
+		return out.String()
+	}
+	return normaliseMarkdown(invisibleChars.Replace(out.String())) + "\n"
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"UTF-8", "Grüße\n", "Grüße\n"},
+		{"UTF-8 BOM", "\xef\xbb\xbfGrüße", "Grüße"},
+		{"UTF-16 LE", "\xff\xfeG\x00r\x00\xfc\x00\r\x00\n\x00", "Grü\n"},
+		{"UTF-16 BE", "\xfe\xff\x00G\x00r\x00\xfc", "Grü"},
+		{"Windows-1252", "Gr\xfc\xdfe \x93quoted\x94", "Grüße “quoted”"},
+		{"line endings", "one\r\ntwo\rthree\n", "one\ntwo\nthree\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeText([]byte(tt.data)); got != tt.want {
+				t.Errorf("decodeText(%q) = %q, want %q", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRawText(t *testing.T) {
+	doc := sourceDocument{Segments: []sourceSegment{
+		{Location: sourceLocation{Unit: "page", Start: "1"}, Text: "First  \u200bpage.   \n\n\n\nStill first."},
+		{Location: sourceLocation{Unit: "page", Start: "1"}, Text: "```\ncode   \n\n\n```"},
+		{Location: sourceLocation{Unit: "page", Start: "2"}, Text: "Second page."},
+	}}
+	tests := []struct {
+		name    string
+		cleanup bool
+		want    string
+	}{
+		{"cleanup", true, "<!-- zettelflow:location page 1 -->\nFirst  page.\n\nStill first.\n\n```\ncode   \n\n\n```\n\n<!-- zettelflow:location page 2 -->\nSecond page.\n"},
+		{"as is", false, "<!-- zettelflow:location page 1 -->\nFirst  \u200bpage.   \n\n\n\nStill first.\n\n```\ncode   \n\n\n```\n\n<!-- zettelflow:location page 2 -->\nSecond page."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rawText(doc, tt.cleanup); got != tt.want {
+				t.Errorf("rawText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRawIngest(t *testing.T) {
+	testConfig(t)
+	viper.Set("ingest.raw_extensions", []string{"md", ".TXT"})
+	tests := []struct {
+		path  string
+		flags map[string]string
+		want  bool
+	}{
+		{"notes.md", nil, true},
+		{"notes.txt", nil, true},
+		{"paper.pdf", nil, false},
+		{"README", nil, false},
+		{"paper.pdf", map[string]string{"raw": "true"}, true},
+	}
+	for _, tt := range tests {
+		setFlags(t, ingestCmd, tt.flags)
+		if got := isRawIngest(tt.path, ingestCmd); got != tt.want {
+			t.Errorf("isRawIngest(%q) with %v = %v, want %v", tt.path, tt.flags, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// ignoreFileName is read from every directory visited during a directory ingest.
+const ignoreFileName = ".zettelignore"
+
+// skippedSource records a file that directory ingest passed over, and why.
+type skippedSource struct {
+	Path   string
+	Reason string
+}
+
+// sourceFilter decides which files of a directory are ingested.
+type sourceFilter struct {
+	recursive bool
+	include   []*regexp.Regexp
+	exclude   []*regexp.Regexp
+	maxSize   int64
+}
+
+// newSourceFilter builds the filter from the ingest flags, falling back to the configuration.
+func newSourceFilter(cmd *cobra.Command) (sourceFilter, error) {
+	recursive, _ := cmd.Flags().GetBool("recursive")
+	include, _ := cmd.Flags().GetStringSlice("include")
+	exclude, _ := cmd.Flags().GetStringSlice("exclude")
+	maxSizeMB, _ := cmd.Flags().GetInt("max-size")
+	if maxSizeMB == 0 {
+		maxSizeMB = viper.GetInt("ingest.max_file_size_mb")
+	}
+
+	filter := sourceFilter{recursive: recursive, maxSize: int64(maxSizeMB) << 20}
+	for _, glob := range include {
+		pattern, err := globPattern(glob, false)
+		if err != nil {
+			return filter, fmt.Errorf("--include: %w", err)
+		}
+		filter.include = append(filter.include, pattern)
+	}
+	for _, glob := range exclude {
+		pattern, err := globPattern(glob, false)
+		if err != nil {
+			return filter, fmt.Errorf("--exclude: %w", err)
+		}
+		filter.exclude = append(filter.exclude, pattern)
+	}
+	return filter, nil
+}
+
+// collect walks root and returns the files to ingest in lexical order, together with
+// every file that was skipped. Ignored directories are not descended into. A Maildir
+// contributes the messages in its cur and new directories; a Maildir given as the
+// root is read without --recursive. An invalid .zettelignore stops the walk.
+func (f sourceFilter) collect(root string) ([]string, []skippedSource, error) {
+	var files []string
+	var skipped []skippedSource
+	ignores := map[string]*ignoreRules{}
+	maildirs := map[string]bool{}
+	root = filepath.Clean(root)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			skipped = append(skipped, skippedSource{Path: path, Reason: err.Error()})
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			maildirs[path] = isMaildir(path)
+			ignores[path], err = loadIgnoreRules(path, nil)
+			return err
+		}
+		rules := ignores[filepath.Dir(path)]
+
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			if d.Name() != ignoreFileName {
+				skipped = append(skipped, skippedSource{Path: path, Reason: "hidden file"})
+			}
+			return nil
+		}
+		if rules.ignored(path, d.IsDir()) {
+			skipped = append(skipped, skippedSource{Path: path, Reason: "matched " + ignoreFileName})
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if maildirs[filepath.Dir(path)] {
+			// Only the delivered messages of a Maildir are sources; tmp holds deliveries
+			// in progress and the files next to cur and new are mail server state.
+			switch {
+			case d.IsDir() && (d.Name() == "cur" || d.Name() == "new"):
+				ignores[path] = rules
+				return nil
+			case d.IsDir():
+				return filepath.SkipDir
+			default:
+				skipped = append(skipped, skippedSource{Path: path, Reason: "Maildir metadata"})
+				return nil
+			}
+		}
+		if d.IsDir() {
+			if !f.recursive {
+				skipped = append(skipped, skippedSource{Path: path, Reason: "directory (use --recursive)"})
+				return filepath.SkipDir
+			}
+			maildirs[path] = isMaildir(path)
+			ignores[path], err = loadIgnoreRules(path, rules)
+			return err
+		}
+
+		if len(f.include) > 0 && !matchesAny(f.include, rel) {
+			skipped = append(skipped, skippedSource{Path: path, Reason: "not matched by --include"})
+			return nil
+		}
+		if matchesAny(f.exclude, rel) {
+			skipped = append(skipped, skippedSource{Path: path, Reason: "matched --exclude"})
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			skipped = append(skipped, skippedSource{Path: path, Reason: err.Error()})
+			return nil
+		}
+		if reason := f.check(path, info); reason != "" {
+			skipped = append(skipped, skippedSource{Path: path, Reason: reason})
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	return files, skipped, err
+}
+
+// check applies the per-file guards: regular files only, the size limit, and binary
+// detection. It returns the reason for skipping the file, or "" to ingest it.
+func (f sourceFilter) check(path string, info os.FileInfo) string {
+	if !info.Mode().IsRegular() {
+		return "not a regular file"
+	}
+	if f.maxSize > 0 && info.Size() > f.maxSize {
+		return fmt.Sprintf("larger than %d MB (%.1f MB)", f.maxSize>>20, float64(info.Size())/(1<<20))
+	}
+	if info.Size() == 0 {
+		return "empty file"
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err.Error()
+	}
+	defer file.Close()
+	head := make([]byte, 8000)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err.Error()
+	}
+	head = head[:n]
+	for _, e := range sourceExtractors {
+		if e.detect(path, head) {
+			return ""
+		}
+	}
+	if looksBinary(head) {
+		return "binary file"
+	}
+	return ""
+}
+
+// looksBinary reports whether data is unlikely to be text: it contains NUL bytes, or
+// more than 30% of its bytes are control characters. UTF-16 text, which is full of NUL
+// bytes, is recognised by its byte order mark.
+func looksBinary(data []byte) bool {
+	if hasUTF16BOM(data) {
+		return false
+	}
+	control := 0
+	for _, b := range data {
+		if b == 0 {
+			return true
+		}
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f' && b != '\b' && b != 0x1b {
+			control++
+		}
+	}
+	return len(data) > 0 && control*10 > len(data)*3
+}
+
+func matchesAny(patterns []*regexp.Regexp, rel string) bool {
+	base := rel[strings.LastIndex(rel, "/")+1:]
+	for _, p := range patterns {
+		if p.MatchString(rel) || p.MatchString(base) {
+			return true
+		}
+	}
+	return false
+}
+
+// printSourceSummary reports how many files were ingested and lists the skipped ones.
+func printSourceSummary(processed int, skipped []skippedSource) {
+	pterm.Println()
+	pterm.Info.Printf("Ingested %d file(s), skipped %d.\n", processed, len(skipped))
+	if len(skipped) == 0 {
+		return
+	}
+	rows := pterm.TableData{{"Skipped file", "Reason"}}
+	for _, s := range skipped {
+		rows = append(rows, []string{s.Path, s.Reason})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+}
+
+// ignoreRule is one line of a .zettelignore file.
+type ignoreRule struct {
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreRules holds the rules of one directory's .zettelignore, chained to the rules
+// of its parent directories as in gitignore.
+type ignoreRules struct {
+	base   string
+	rules  []ignoreRule
+	parent *ignoreRules
+}
+
+// loadIgnoreRules reads dir/.zettelignore. Directories without one inherit the parent's rules.
+func loadIgnoreRules(dir string, parent *ignoreRules) (*ignoreRules, error) {
+	path := filepath.Join(dir, ignoreFileName)
+	file, err := os.Open(path)
+	if err != nil {
+		return parent, nil
+	}
+	defer file.Close()
+
+	rules := &ignoreRules{base: dir, parent: parent}
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		// A slash anywhere but the end anchors the pattern to the directory of the ignore file.
+		anchored := strings.Contains(line, "/")
+		if rule.pattern, err = globPattern(strings.TrimPrefix(line, "/"), anchored); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, number, err)
+		}
+		rules.rules = append(rules.rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// ignored reports whether path is excluded. As in gitignore, the last matching rule
+// wins and rules in deeper directories take precedence over their parents.
+func (r *ignoreRules) ignored(path string, isDir bool) bool {
+	for rules := r; rules != nil; rules = rules.parent {
+		rel, err := filepath.Rel(rules.base, path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for i := len(rules.rules) - 1; i >= 0; i-- {
+			rule := rules.rules[i]
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if rule.pattern.MatchString(rel) {
+				return !rule.negate
+			}
+		}
+	}
+	return false
+}
+
+// globPattern compiles a gitignore-style glob. "*" and "?" never cross a "/", "**"
+// matches any number of directories, and unanchored patterns may match at any depth.
+func globPattern(glob string, anchored bool) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			if end := strings.IndexByte(glob[i+1:], ']'); end > 0 {
+				class := glob[i+1 : i+1+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				b.WriteString("[" + class + "]")
+				i += end + 1
+				continue
+			}
+			b.WriteString(`\[`)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	// A match on a directory also covers everything below it.
+	b.WriteString("(?:/.*)?$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", glob, err)
+	}
+	return re, nil
+}
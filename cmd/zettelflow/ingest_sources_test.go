@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGlobPattern(t *testing.T) {
+	tests := []struct {
+		glob     string
+		anchored bool
+		path     string
+		want     bool
+	}{
+		{"*.md", false, "notes/a.md", true},
+		{"*.md", false, "a.txt", false},
+		{"*.md", true, "notes/a.md", false},
+		{"notes/*.md", true, "notes/a.md", true},
+		{"notes/*.md", true, "notes/deep/a.md", false},
+		{"notes/**/*.md", true, "notes/deep/er/a.md", true},
+		{"**/drafts", false, "a/b/drafts/x.md", true},
+		{"file?.txt", false, "file1.txt", true},
+		{"file?.txt", false, "file/.txt", false},
+		{"[ab].md", false, "b.md", true},
+		{"[!ab].md", false, "b.md", false},
+		{"[!ab].md", false, "c.md", true},
+		{"a+b(1).md", false, "a+b(1).md", true},
+		{"build", false, "build/out/x.md", true},
+		{"[unclosed", false, "[unclosed", true},
+	}
+	for _, tt := range tests {
+		re, err := globPattern(tt.glob, tt.anchored)
+		if err != nil {
+			t.Errorf("globPattern(%q) error = %v", tt.glob, err)
+			continue
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("globPattern(%q, %v) matches %q = %v, want %v", tt.glob, tt.anchored, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGlobPatternInvalid(t *testing.T) {
+	for _, glob := range []string{"[z-a]", "*.[b-a]d"} {
+		if _, err := globPattern(glob, false); err == nil || !strings.Contains(err.Error(), glob) {
+			t.Errorf("globPattern(%q) error = %v, want an error naming the pattern", glob, err)
+		}
+	}
+}
+
+func TestLoadIgnoreRules(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(root, ignoreFileName), "# comment\n*.log\n/top.md\ndrafts/\n!keep.log\n")
+	writeTestFile(t, filepath.Join(sub, ignoreFileName), "*.md\n")
+
+	parent, err := loadIgnoreRules(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := loadIgnoreRules(sub, parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rules *ignoreRules
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{parent, "debug.log", false, true},
+		{parent, "keep.log", false, false},
+		{parent, "top.md", false, true},
+		{parent, "other.md", false, false},
+		{parent, "drafts", true, true},
+		{parent, "drafts", false, false},
+		{rules, "sub/top.md", false, true},
+		{rules, "sub/x.log", false, true},
+		{rules, "sub/x.txt", false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.rules.ignored(filepath.Join(root, tt.path), tt.isDir); got != tt.want {
+			t.Errorf("ignored(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+
+	// Directories without an ignore file inherit their parent's rules.
+	empty := t.TempDir()
+	if got, err := loadIgnoreRules(empty, parent); err != nil || got != parent {
+		t.Errorf("loadIgnoreRules() without %s = %v, %v, want the parent rules", ignoreFileName, got, err)
+	}
+}
+
+func TestLoadIgnoreRulesInvalid(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, ignoreFileName), "*.log\n[z-a]\n")
+	_, err := loadIgnoreRules(dir, nil)
+	if err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("loadIgnoreRules() error = %v, want an error for line 2", err)
+	}
+	if _, _, err := (sourceFilter{}).collect(dir); err == nil {
+		t.Error("collect() with an invalid ignore file succeeded")
+	}
+}
+
+func TestSourceFilterCollect(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "a.md"), "text")
+	writeTestFile(t, filepath.Join(root, "b.txt"), "text")
+	writeTestFile(t, filepath.Join(root, "empty.md"), "")
+	writeTestFile(t, filepath.Join(root, ".hidden.md"), "text")
+	writeTestFile(t, filepath.Join(root, "blob.md"), "\x00\x01\x02binary")
+	writeTestFile(t, filepath.Join(root, "sub", "c.md"), "text")
+
+	include, _ := globPattern("*.md", false)
+	filter := sourceFilter{include: []*regexp.Regexp{include}}
+	files, skipped, err := filter.collect(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(root, "a.md")}; !reflect.DeepEqual(files, want) {
+		t.Errorf("collect() files = %q, want %q", files, want)
+	}
+	reasons := map[string]string{}
+	for _, s := range skipped {
+		reasons[filepath.Base(s.Path)] = s.Reason
+	}
+	for name, want := range map[string]string{
+		"b.txt":      "not matched by --include",
+		"empty.md":   "empty file",
+		".hidden.md": "hidden file",
+		"blob.md":    "binary file",
+		"sub":        "directory (use --recursive)",
+	} {
+		if reasons[name] != want {
+			t.Errorf("%s skipped for %q, want %q", name, reasons[name], want)
+		}
+	}
+
+	filter.recursive = true
+	if files, _, _ := filter.collect(root); len(files) != 2 {
+		t.Errorf("recursive collect() = %q, want a.md and sub/c.md", files)
+	}
+}
+
+func TestLooksBinary(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want bool
+	}{
+		{"text", "plain text\n", false},
+		{"NUL", "PK\x03\x04\x00\x00", true},
+		{"control characters", "\x01\x02\x03\x04ab", true},
+		{"UTF-16 LE", "\xff\xfeh\x00i\x00", false},
+		{"UTF-16 BE", "\xfe\xff\x00h\x00i", false},
+	}
+	for _, tt := range tests {
+		if got := looksBinary([]byte(tt.data)); got != tt.want {
+			t.Errorf("looksBinary(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// writeTestFile writes content to path, creating its directory.
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
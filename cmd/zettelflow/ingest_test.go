@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// testConfig loads the default configuration with all data directories in a temporary
+// directory, which it returns, for the duration of a test.
+func testConfig(t *testing.T) string {
+	t.Helper()
+	viper.Reset()
+	setDefaults()
+	dir := t.TempDir()
+	for _, key := range []string{"ingest", "split", "enrich", "journal", "templates"} {
+		path := filepath.Join(dir, key)
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+		viper.Set("paths."+key, path)
+	}
+	viper.Set("paths.manifest", filepath.Join(dir, "manifest.json"))
+	viper.Set("paths.folgezettel", filepath.Join(dir, "folgezettel.json"))
+	viper.Set("split.output_extension", ".md")
+	t.Cleanup(viper.Reset)
+	return dir
+}
+
+// setFlags sets flags of cmd for the duration of a test.
+func setFlags(t *testing.T, cmd *cobra.Command, values map[string]string) {
+	t.Helper()
+	for name, value := range values {
+		if err := cmd.Flags().Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		cmd.Flags().VisitAll(func(f *pflag.Flag) {
+			if !f.Changed {
+				return
+			}
+			if slice, ok := f.Value.(pflag.SliceValue); ok {
+				slice.Replace(nil)
+			} else {
+				f.Value.Set(f.DefValue)
+			}
+			f.Changed = false
+		})
+	})
+}
+
+func TestIngestFileSourceError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scan.pdf")
+	writeTestFile(t, path, "%PDF-1.4\ngarbage\n")
+
+	_, err := ingestFile(path, &ingestManifest{}, ingestCmd)
+	var unreadable sourceError
+	if !errors.As(err, &unreadable) {
+		t.Errorf("ingestFile() of a broken PDF = %v, want a sourceError", err)
+	}
+
+	setFlags(t, ingestCmd, map[string]string{"format": "nonsense"})
+	if _, err := ingestFile(path, &ingestManifest{}, ingestCmd); err == nil || errors.As(err, &unreadable) {
+		t.Errorf("ingestFile() with an unknown format = %v, want an error that stops the run", err)
+	}
+}
+
+func TestIngestUTF16(t *testing.T) {
+	dir := testConfig(t)
+	setFlags(t, ingestCmd, map[string]string{"raw": "true"})
+
+	sources := filepath.Join(dir, "sources")
+	// "Grüße\r\n###\r\nZweite Notiz" in UTF-16 LE with a byte order mark.
+	var utf16 []byte
+	utf16 = append(utf16, 0xff, 0xfe)
+	for _, r := range "Grüße\r\n###\r\nZweite Notiz" {
+		utf16 = append(utf16, byte(r), byte(r>>8))
+	}
+	writeTestFile(t, filepath.Join(sources, "notes.txt"), string(utf16))
+
+	files, skipped, err := (sourceFilter{}).collect(sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || len(skipped) != 0 {
+		t.Fatalf("collect() = %q, skipped %v, want the UTF-16 file", files, skipped)
+	}
+	manifest, err := loadManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason, err := ingestFile(files[0], manifest, ingestCmd); reason != "" || err != nil {
+		t.Fatalf("ingestFile() = %q, %v", reason, err)
+	}
+	outputs, _ := filepath.Glob(filepath.Join(dir, "ingest", "*.txt"))
+	if len(outputs) != 1 {
+		t.Fatalf("ingest wrote %q, want one file", outputs)
+	}
+	data, err := os.ReadFile(outputs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, body := splitFrontmatter(string(data)); body != "Grüße\n###\nZweite Notiz\n" {
+		t.Errorf("ingest output = %q, want the decoded text", body)
+	}
+}
+
+func TestIngestGrownMbox(t *testing.T) {
+	dir := testConfig(t)
+	setFlags(t, ingestCmd, map[string]string{"raw": "true"})
+	path := filepath.Join(dir, "sources", "archive.mbox")
+	later := "\nFrom carol@example.com Thu Mar  5 10:00:00 2020\n" +
+		"From: Carol <carol@example.com>\n" +
+		"Subject: Third\n" +
+		"Message-ID: <3@example.com>\n" +
+		"\n" +
+		"Only this one is new.\n"
+
+	steps := []struct {
+		content    string
+		wantReason string
+		wantNew    int
+	}{
+		{testMbox, "", 2},
+		{testMbox, "unchanged since", 0},
+		{testMbox + later, "", 1},
+		{later + "\n" + testMbox, "all 3 document(s) were ingested before", 0},
+	}
+	total := 0
+	for i, step := range steps {
+		writeTestFile(t, path, step.content)
+		manifest, err := loadManifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		reason, err := ingestFile(path, manifest, ingestCmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if step.wantReason == "" && reason != "" || !strings.Contains(reason, step.wantReason) {
+			t.Errorf("step %d: ingestFile() = %q, want %q", i+1, reason, step.wantReason)
+		}
+		total += step.wantNew
+		if outputs, _ := filepath.Glob(filepath.Join(dir, "ingest", "*")); len(outputs) != total {
+			t.Errorf("step %d: ingest holds %d files, want %d", i+1, len(outputs), total)
+		}
+	}
+}
+
+func TestIngestPrompt(t *testing.T) {
+	transcript := []sourceSegment{
+		{Location: sourceLocation{Unit: "time", Start: "00:00:05", End: "00:00:09"}, Text: "**Alice:** Let's start."},
+		{Location: sourceLocation{Unit: "time", Start: "00:12:34", End: "00:13:10"}, Text: "**Bob:** Next topic."},
+	}
+	tests := []struct {
+		name     string
+		segments []sourceSegment
+		want     string
+	}{
+		{"plain", []sourceSegment{{Text: "one"}, {Text: "two"}}, "Notes:\none\n\ntwo"},
+		{"located", transcript, "Notes:\n" +
+			"<!-- zettelflow:location time 00:00:05-00:00:09 -->\n**Alice:** Let's start.\n\n" +
+			"<!-- zettelflow:location time 00:12:34-00:13:10 -->\n**Bob:** Next topic.\n\n" + locationInstruction},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ingestPrompt("Notes:\n{input_text}", tt.segments); got != tt.want {
+				t.Errorf("ingestPrompt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
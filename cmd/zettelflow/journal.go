@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// journalFile is a file written by a run, with the hash of what was written.
+type journalFile struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+// journalMove is a file moved by a run, with the hash of its content.
+type journalMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Hash string `json:"hash"`
+}
+
+// runJournal records what one split run did to the file system, so that undo can
+// reverse it. It is saved after every operation, so an interrupted run can be undone too.
+type runJournal struct {
+	path      string
+	ID        string        `json:"id"`
+	Command   string        `json:"command"`
+	StartedAt time.Time     `json:"started_at"`
+	Created   []journalFile `json:"created"`
+	Moved     []journalMove `json:"moved"`
+	UndoneAt  *time.Time    `json:"undone_at,omitempty"`
+}
+
+// newJournal starts the journal of a run in paths.journal. Its ID is the start time,
+// with a suffix if another run started in the same second.
+func newJournal(command string) (*runJournal, error) {
+	dir := expandPath(viper.GetString("paths.journal"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	j := &runJournal{Command: command, StartedAt: now.UTC().Truncate(time.Second)}
+	for attempt := 1; ; attempt++ {
+		j.ID = now.Format("20060102-150405")
+		if attempt > 1 {
+			j.ID += "-" + strconv.Itoa(attempt)
+		}
+		j.path = filepath.Join(dir, j.ID+".json")
+		// Claim the ID before anything else can.
+		if err := writeNewFile(j.path, []byte("{}\n")); err == nil {
+			break
+		} else if !errors.Is(err, os.ErrExist) || attempt == maxNameAttempts {
+			return nil, err
+		}
+	}
+	return j, j.save()
+}
+
+// created records a file written by the run.
+func (j *runJournal) created(path string, data []byte) error {
+	j.Created = append(j.Created, journalFile{Path: path, Hash: hashContent(data)})
+	return j.save()
+}
+
+// moved records a file moved by the run, with the hash of its content.
+func (j *runJournal) moved(from, to, hash string) error {
+	j.Moved = append(j.Moved, journalMove{From: from, To: to, Hash: hash})
+	return j.save()
+}
+
+func (j *runJournal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(j.path, append(data, '\n'))
+}
+
+// rewritten records that a later command rewrote a file created by a run, such as a
+// structure note retitled by enrich, so that undo does not take the rewrite for an edit.
+// Only journals of runs not yet undone that recorded the file as before are updated.
+func rewritten(path string, before, after []byte) error {
+	journals, err := loadJournals()
+	if err != nil {
+		return err
+	}
+	from, to := hashContent(before), hashContent(after)
+	for _, j := range journals {
+		if j.UndoneAt != nil {
+			continue
+		}
+		changed := false
+		for i, f := range j.Created {
+			if f.Path == path && f.Hash == from {
+				j.Created[i].Hash = to
+				changed = true
+			}
+		}
+		if changed {
+			if err := j.save(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// derived records a file that a later command made from a file a run created, such as
+// the enriched copy of a split note, in the journals of runs not yet undone that created
+// the original, so that undoing the run removes the copy too.
+func derived(from, path string, data []byte) error {
+	journals, err := loadJournals()
+	if err != nil {
+		return err
+	}
+	hash := hashContent(data)
+	for _, j := range journals {
+		if j.UndoneAt != nil || j.createdIndex(from) < 0 {
+			continue
+		}
+		if i := j.createdIndex(path); i >= 0 {
+			j.Created[i].Hash = hash
+		} else {
+			j.Created = append(j.Created, journalFile{Path: path, Hash: hash})
+		}
+		if err := j.save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createdIndex returns the index of path among the files the run created, or -1.
+func (j *runJournal) createdIndex(path string) int {
+	for i, f := range j.Created {
+		if f.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// loadJournals reads all journals in paths.journal, oldest first.
+func loadJournals() ([]*runJournal, error) {
+	dir := expandPath(viper.GetString("paths.journal"))
+	files, err := ioutil.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var journals []*runJournal
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		j := &runJournal{path: filepath.Join(dir, file.Name())}
+		data, err := os.ReadFile(j.path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, j); err != nil {
+			return nil, fmt.Errorf("reading journal %s: %w", j.path, err)
+		}
+		if j.ID != "" {
+			journals = append(journals, j)
+		}
+	}
+	sort.SliceStable(journals, func(a, b int) bool { return journals[a].StartedAt.Before(journals[b].StartedAt) })
+	return journals, nil
+}
+
+// undoProblems lists the reasons the run cannot be undone: generated files that were
+// changed since, and moved files that are gone or whose original place is taken.
+func (j *runJournal) undoProblems() []string {
+	var problems []string
+	for _, f := range j.Created {
+		data, err := os.ReadFile(f.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			problems = append(problems, err.Error())
+		} else if hashContent(data) != f.Hash {
+			problems = append(problems, fmt.Sprintf("%s was modified since the run", f.Path))
+		}
+	}
+	for _, m := range j.Moved {
+		data, err := os.ReadFile(m.To)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("cannot restore %s: %v", m.From, err))
+		} else if hashContent(data) != m.Hash {
+			problems = append(problems, fmt.Sprintf("%s was modified since the run", m.To))
+		}
+		if _, err := os.Lstat(m.From); err == nil {
+			problems = append(problems, fmt.Sprintf("cannot restore %s: the file exists", m.From))
+		}
+	}
+	return problems
+}
+
+// undo deletes the files the run created and moves the files it moved back. It checks
+// everything first, so a run is undone completely or not at all.
+func (j *runJournal) undo(dryRun bool) error {
+	if problems := j.undoProblems(); len(problems) > 0 {
+		return fmt.Errorf("cannot undo run %s:\n  %s", j.ID, strings.Join(problems, "\n  "))
+	}
+	for _, f := range j.Created {
+		if _, err := os.Lstat(f.Path); errors.Is(err, os.ErrNotExist) {
+			pterm.Warning.Printf("  - Already deleted: %s\n", f.Path)
+			continue
+		}
+		if dryRun {
+			pterm.Info.Printf("  - [Dry Run] Would delete: %s\n", f.Path)
+			continue
+		}
+		if err := os.Remove(f.Path); err != nil {
+			return err
+		}
+		pterm.Success.Printf("  - Deleted: %s\n", f.Path)
+	}
+	for _, m := range j.Moved {
+		if dryRun {
+			pterm.Info.Printf("  - [Dry Run] Would restore: %s\n", m.From)
+			continue
+		}
+		if err := os.Rename(m.To, m.From); err != nil {
+			return err
+		}
+		pterm.Success.Printf("  - Restored: %s\n", m.From)
+	}
+	if dryRun {
+		return nil
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	j.UndoneAt = &now
+	return j.save()
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo [run-id]",
+	Short: "Undo a split run: delete its notes and restore its ingest files.",
+	Long: `Reverses a split run recorded in the journal: deletes the notes it created, and the
+enriched copies made of them, and moves the files it split back from ingest/processed.
+Without a run ID, the latest run that has not been undone is undone. Refuses if any of
+these notes was modified since it was written; titles that enrich writes into a
+structure note do not count.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		journals, err := loadJournals()
+		cobra.CheckErr(err)
+
+		if list, _ := cmd.Flags().GetBool("list"); list {
+			if len(journals) == 0 {
+				pterm.Info.Println("No runs recorded.")
+				return
+			}
+			rows := pterm.TableData{{"Run", "Command", "Started", "Created", "Moved", "Undone"}}
+			for _, j := range journals {
+				undone := ""
+				if j.UndoneAt != nil {
+					undone = j.UndoneAt.Local().Format("2006-01-02 15:04")
+				}
+				rows = append(rows, []string{
+					j.ID,
+					j.Command,
+					j.StartedAt.Local().Format("2006-01-02 15:04:05"),
+					strconv.Itoa(len(j.Created)),
+					strconv.Itoa(len(j.Moved)),
+					undone,
+				})
+			}
+			pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+			return
+		}
+
+		var run *runJournal
+		for i := len(journals) - 1; i >= 0; i-- {
+			j := journals[i]
+			if (len(args) == 0 && j.UndoneAt == nil) || (len(args) == 1 && j.ID == args[0]) {
+				run = j
+				break
+			}
+		}
+		switch {
+		case run == nil && len(args) == 1:
+			cobra.CheckErr(fmt.Errorf("no run %q in the journal (see zettelflow undo --list)", args[0]))
+		case run == nil:
+			pterm.Info.Println("Nothing to undo.")
+			return
+		case run.UndoneAt != nil:
+			cobra.CheckErr(fmt.Errorf("run %s was already undone", run.ID))
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		pterm.Info.Printf("Undoing %s run %s (%d files created, %d moved)...\n", run.Command, run.ID, len(run.Created), len(run.Moved))
+		cobra.CheckErr(run.undo(dryRun))
+		if !dryRun {
+			pterm.Success.Printf("Run %s undone.\n", run.ID)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+	undoCmd.Flags().BoolP("list", "l", false, "List the recorded runs instead of undoing one")
+	undoCmd.Flags().BoolP("dry-run", "d", false, "Show what would be deleted and restored")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestUndoAfterEnrich(t *testing.T) {
+	tests := []struct {
+		name   string
+		edit   string // "structure" or "enriched": the file edited by hand after enrich
+		undone bool
+	}{
+		{"enriched", "", true},
+		{"edited structure note", "structure", false},
+		{"edited enriched note", "enriched", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testConfig(t)
+			viper.Set("split.structure_note", true)
+			// Without a title in the notes, enrich gives them new ones, which it then
+			// writes into the structure note.
+			viper.Set("split.template", "untitled")
+			writeTestFile(t, filepath.Join(dir, "templates", "untitled.md"), "---\nid: {{ .ID | yaml }}\n---\n{{ .Content }}\n")
+			source := filepath.Join(dir, "ingest", "source.txt")
+			writeTestFile(t, source, "# First idea\n\nSome text.\n\n###\n\n# Second idea\n\nMore text.\n")
+
+			if _, err := splitPending(splitCmd); err != nil {
+				t.Fatal(err)
+			}
+			if err := enrichPending("local", nil); err != nil {
+				t.Fatal(err)
+			}
+			journals, err := loadJournals()
+			if err != nil || len(journals) != 1 {
+				t.Fatalf("loadJournals() = %v, %v, want one run", journals, err)
+			}
+			enriched, _ := filepath.Glob(filepath.Join(dir, "enrich", "*.md"))
+			edited := map[string]string{}
+			for _, path := range enriched {
+				if strings.HasPrefix(filepath.Base(path), "structure") {
+					edited["structure"] = path
+				} else {
+					edited["enriched"] = path
+				}
+			}
+			if len(enriched) != 3 || edited["structure"] == "" {
+				t.Fatalf("enrich dir holds %q, want a structure note and two enriched notes", enriched)
+			}
+			if path := edited[tt.edit]; path != "" {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				writeTestFile(t, path, string(data)+"\nMy own remark.\n")
+			}
+
+			err = journals[0].undo(false)
+			if !tt.undone {
+				if err == nil || !strings.Contains(err.Error(), "modified since the run") {
+					t.Errorf("undo() with an edited %s note = %v, want a refusal", tt.edit, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("undo() after enrich = %v", err)
+			}
+			for _, sub := range []string{"split", "enrich"} {
+				if left, _ := filepath.Glob(filepath.Join(dir, sub, "*.md")); len(left) > 0 {
+					t.Errorf("undo() left %q in the %s dir", left, sub)
+				}
+			}
+			if _, err := os.Stat(source); err != nil {
+				t.Errorf("undo() did not restore the source: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// manifestEntry records one ingest of one version of a source.
+type manifestEntry struct {
+	Source     string    `json:"source"`
+	Hash       string    `json:"hash"`
+	Version    int       `json:"version"`
+	IngestedAt time.Time `json:"ingested_at"`
+	Outputs    []string  `json:"outputs"`
+	Documents  []string  `json:"documents,omitempty"` // documentKey of every document ingested
+}
+
+// ingestManifest is the history of everything ingest has sent to the LLM. It lets a
+// re-run skip sources whose content has not changed since they were last ingested, and
+// the documents of a changed source that were ingested before.
+type ingestManifest struct {
+	path    string
+	Entries []manifestEntry `json:"entries"`
+}
+
+// loadManifest reads the manifest at paths.manifest. A missing file is an empty manifest.
+func loadManifest() (*ingestManifest, error) {
+	m := &ingestManifest{path: expandPath(viper.GetString("paths.manifest"))}
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("reading manifest %s: %w", m.path, err)
+	}
+	return m, nil
+}
+
+// findHash returns the most recent ingest of content with the given hash, from any path.
+func (m *ingestManifest) findHash(hash string) *manifestEntry {
+	for i := len(m.Entries) - 1; i >= 0; i-- {
+		if m.Entries[i].Hash == hash {
+			return &m.Entries[i]
+		}
+	}
+	return nil
+}
+
+// findDocument returns the most recent ingest that included the document with the given
+// key, from any source.
+func (m *ingestManifest) findDocument(key string) *manifestEntry {
+	for i := len(m.Entries) - 1; i >= 0; i-- {
+		for _, k := range m.Entries[i].Documents {
+			if k == key {
+				return &m.Entries[i]
+			}
+		}
+	}
+	return nil
+}
+
+// documentKey identifies a document across versions of its source, so that only the new
+// documents of a mailbox or chat export that has grown are ingested: an email by its
+// Message-ID, a conversation by its ID and last update, anything else by its content.
+func documentKey(doc sourceDocument) string {
+	if id := doc.Meta["message_id"]; id != "" {
+		return "message:" + id
+	}
+	if id := doc.Meta["conversation"]; id != "" {
+		return "conversation:" + doc.Meta["platform"] + ":" + id + "@" + doc.Meta["updated"]
+	}
+	// Locations such as "message 3" change when a mailbox is reordered, so they are left out.
+	text := []string{doc.Title}
+	for _, s := range doc.Segments {
+		text = append(text, s.Text)
+	}
+	return hashContent([]byte(strings.Join(text, "\n\n")))
+}
+
+// nextVersion returns the version number the next ingest of source will get.
+func (m *ingestManifest) nextVersion(source string) int {
+	version := 0
+	for _, e := range m.Entries {
+		if e.Source == source && e.Version > version {
+			version = e.Version
+		}
+	}
+	return version + 1
+}
+
+// record adds an ingest of the documents docs of origin to the manifest and writes it to
+// disk, so that an interrupted directory ingest does not repeat the files it already
+// finished.
+func (m *ingestManifest) record(origin sourceOrigin, docs []sourceDocument, outputs []string) error {
+	keys := make([]string, len(docs))
+	for i, doc := range docs {
+		keys[i] = documentKey(doc)
+	}
+	m.Entries = append(m.Entries, manifestEntry{
+		Source:     origin.Path,
+		Hash:       origin.Hash,
+		Version:    origin.Version,
+		IngestedAt: time.Now().UTC().Truncate(time.Second),
+		Outputs:    outputs,
+		Documents:  keys,
+	})
+	return m.save()
+}
+
+// save writes the manifest, creating its directory if needed.
+func (m *ingestManifest) save() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(m.path, append(data, '\n'))
+}
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Show which sources have been ingested, and when.",
+	Long:  `Lists the sources recorded in the ingest manifest with their current version, content hash, ingest time and output files.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		manifest, err := loadManifest()
+		cobra.CheckErr(err)
+		if len(manifest.Entries) == 0 {
+			pterm.Info.Printf("No sources ingested yet (%s).\n", manifest.path)
+			return
+		}
+
+		all, _ := cmd.Flags().GetBool("all")
+		entries := manifest.Entries
+		if !all {
+			// Only the latest version of every source.
+			latest := map[string]int{}
+			for i, e := range manifest.Entries {
+				latest[e.Source] = i
+			}
+			entries = nil
+			for _, i := range latest {
+				entries = append(entries, manifest.Entries[i])
+			}
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			if entries[i].Source != entries[j].Source {
+				return entries[i].Source < entries[j].Source
+			}
+			return entries[i].Version < entries[j].Version
+		})
+
+		rows := pterm.TableData{{"Source", "Version", "Hash", "Ingested", "Outputs"}}
+		for _, e := range entries {
+			hash := e.Hash
+			if len(hash) > 19 {
+				hash = hash[:19]
+			}
+			outputs := make([]string, len(e.Outputs))
+			for i, o := range e.Outputs {
+				outputs[i] = filepath.Base(o)
+			}
+			rows = append(rows, []string{
+				e.Source,
+				strconv.Itoa(e.Version),
+				hash,
+				e.IngestedAt.Local().Format("2006-01-02 15:04"),
+				strings.Join(outputs, ", "),
+			})
+		}
+		pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+		pterm.Info.Printf("Manifest: %s\n", manifest.path)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(manifestCmd)
+	manifestCmd.Flags().BoolP("all", "a", false, "Show every ingested version, not only the latest")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManifestSkipReason(t *testing.T) {
+	manifest := &ingestManifest{Entries: []manifestEntry{
+		{Source: "/notes/a.md", Hash: "old", Version: 1, IngestedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Source: "/notes/a.md", Hash: "same", Version: 2, IngestedAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}}
+	tests := []struct {
+		name  string
+		path  string
+		hash  string
+		flags map[string]string
+		want  string // a part of the reason, or "" if the source is ingested
+	}{
+		{"new", "/notes/b.md", "new", nil, ""},
+		{"changed", "/notes/a.md", "changed", nil, ""},
+		{"unchanged", "/notes/a.md", "same", nil, "unchanged since"},
+		{"copy", "/notes/copy.md", "same", nil, "same content as /notes/a.md"},
+		{"older version", "/notes/a.md", "old", nil, "unchanged since"},
+		{"force", "/notes/a.md", "same", map[string]string{"force": "true"}, ""},
+		{"since", "/notes/a.md", "same", map[string]string{"since": "2024-01-01"}, ""},
+		{"subject", "/notes/a.md", "same", map[string]string{"subject": "weekly"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, ingestCmd, tt.flags)
+			got := manifestSkipReason(manifest, sourceOrigin{Path: tt.path, Hash: tt.hash}, ingestCmd)
+			if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+				t.Errorf("manifestSkipReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestRecord(t *testing.T) {
+	testConfig(t)
+	manifest, err := loadManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := manifest.nextVersion("/notes/a.md"); v != 1 {
+		t.Errorf("nextVersion() of a new source = %d, want 1", v)
+	}
+	if err := manifest.record(sourceOrigin{Path: "/notes/a.md", Hash: "h1", Version: 1}, []sourceDocument{plainDocument("text")}, []string{"out.md"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := loadManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := reloaded.nextVersion("/notes/a.md"); v != 2 {
+		t.Errorf("nextVersion() after an ingest = %d, want 2", v)
+	}
+	if e := reloaded.findHash("h1"); e == nil || e.Source != "/notes/a.md" || len(e.Outputs) != 1 {
+		t.Errorf("findHash() = %+v, want the recorded ingest", e)
+	}
+	if e := reloaded.findHash("h2"); e != nil {
+		t.Errorf("findHash() of unknown content = %+v, want nil", e)
+	}
+	if e := reloaded.findDocument(documentKey(plainDocument("text"))); e == nil || e.Source != "/notes/a.md" {
+		t.Errorf("findDocument() = %+v, want the recorded ingest", e)
+	}
+	if e := reloaded.findDocument(documentKey(plainDocument("other text"))); e != nil {
+		t.Errorf("findDocument() of an unknown document = %+v, want nil", e)
+	}
+}
+
+func TestDocumentKey(t *testing.T) {
+	mail := func(id, text string) sourceDocument {
+		return sourceDocument{Title: "Weekly", Meta: map[string]string{"message_id": id}, Segments: []sourceSegment{{Text: text}}}
+	}
+	chat := func(id, updated, text string) sourceDocument {
+		return sourceDocument{Title: "Chat", Meta: map[string]string{"platform": "claude", "conversation": id, "updated": updated}, Segments: []sourceSegment{{Text: text}}}
+	}
+	at := func(unit, start, text string) sourceDocument {
+		return sourceDocument{Title: "Doc", Segments: []sourceSegment{{Location: sourceLocation{Unit: unit, Start: start}, Text: text}}}
+	}
+	tests := []struct {
+		name string
+		a, b sourceDocument
+		same bool
+	}{
+		{"same Message-ID", mail("<1@x>", "Body"), mail("<1@x>", "Body, decoded differently"), true},
+		{"other Message-ID", mail("<1@x>", "Body"), mail("<2@x>", "Body"), false},
+		{"same conversation", chat("c1", "2024-01-01T00:00:00Z", "Hi"), chat("c1", "2024-01-01T00:00:00Z", "Hi"), true},
+		{"continued conversation", chat("c1", "2024-01-01T00:00:00Z", "Hi"), chat("c1", "2024-02-01T00:00:00Z", "Hi, more"), false},
+		{"moved message", at("message", "1", "Text"), at("message", "4", "Text"), true},
+		{"other content", at("page", "1", "Text"), at("page", "1", "Other text"), false},
+		{"other title", plainDocument("Text"), sourceDocument{Title: "T", Segments: []sourceSegment{{Text: "Text"}}}, false},
+	}
+	for _, tt := range tests {
+		if same := documentKey(tt.a) == documentKey(tt.b); same != tt.same {
+			t.Errorf("%s: documentKey() equal = %v, want %v", tt.name, same, tt.same)
+		}
+	}
+}
+
+func TestNewDocuments(t *testing.T) {
+	old, ingested := plainDocument("old"), plainDocument("ingested")
+	manifest := &ingestManifest{Entries: []manifestEntry{
+		{Source: "/mail/a.mbox", Documents: []string{documentKey(old)}, IngestedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Source: "/mail/b.mbox", Documents: []string{documentKey(ingested)}, IngestedAt: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}}
+	fresh := plainDocument("new")
+	tests := []struct {
+		name       string
+		docs       []sourceDocument
+		flags      map[string]string
+		want       []sourceDocument
+		wantReason string
+	}{
+		{"new", []sourceDocument{fresh}, nil, []sourceDocument{fresh}, ""},
+		{"grown", []sourceDocument{old, fresh, ingested}, nil, []sourceDocument{fresh}, ""},
+		{"nothing new", []sourceDocument{old, ingested}, nil, nil, "all 2 document(s) were ingested before"},
+		{"force", []sourceDocument{old, fresh}, map[string]string{"force": "true"}, []sourceDocument{old, fresh}, ""},
+		{"selection", []sourceDocument{old}, map[string]string{"title": "old"}, []sourceDocument{old}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, ingestCmd, tt.flags)
+			got, reason := newDocuments(manifest, tt.docs, ingestCmd)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newDocuments() = %v, want %v", got, tt.want)
+			}
+			if tt.wantReason == "" && reason != "" || !strings.Contains(reason, tt.wantReason) {
+				t.Errorf("newDocuments() reason = %q, want %q", reason, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// sourceOrigin identifies the input an ingest output was produced from.
+type sourceOrigin struct {
+	Path    string // absolute path, or "stdin"
+	Hash    string
+	ModTime time.Time
+	Version int // 1 for the first ingest of Path, incremented when its content changes
+}
+
+// fileOrigin describes a source file read from disk.
+func fileOrigin(path string, data []byte) sourceOrigin {
+	origin := sourceOrigin{Path: path, Hash: hashContent(data)}
+	if abs, err := filepath.Abs(path); err == nil {
+		origin.Path = abs
+	}
+	if info, err := os.Stat(path); err == nil {
+		origin.ModTime = info.ModTime()
+	}
+	return origin
+}
+
+// hashContent returns the content hash recorded as source_hash.
+func hashContent(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// hashFile hashes the content of a file like hashContent, without reading it into memory.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// provenanceHeader builds the frontmatter written at the top of every ingest output:
+// where the text came from, what the source said about itself, and how it was processed.
+// Raw ingests, which have no prompt or model, are marked with ingest: raw.
+func provenanceHeader(origin sourceOrigin, doc sourceDocument, promptFile, model string, at time.Time) (string, error) {
+	header := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setFrontmatterField(header, "source", stringNode(origin.Path))
+	setFrontmatterField(header, "source_hash", stringNode(origin.Hash))
+	if origin.Version > 0 {
+		setFrontmatterField(header, "source_version", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(origin.Version)})
+	}
+	if !origin.ModTime.IsZero() {
+		setFrontmatterField(header, "source_mtime", stringNode(origin.ModTime.Format(time.RFC3339)))
+	}
+	if doc.Title != "" {
+		setFrontmatterField(header, "source_title", stringNode(doc.Title))
+	}
+	keys := make([]string, 0, len(doc.Meta))
+	for key := range doc.Meta {
+		if key == "title" && doc.Title != "" {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		setFrontmatterField(header, "source_"+key, stringNode(doc.Meta[key]))
+	}
+	if model == "" {
+		setFrontmatterField(header, "ingest", stringNode("raw"))
+	} else {
+		setFrontmatterField(header, "prompt", stringNode(promptFile))
+		setFrontmatterField(header, "model", stringNode(model))
+	}
+	setFrontmatterField(header, "ingested_at", stringNode(at.Format(time.RFC3339)))
+	return marshalFrontmatter(header)
+}
+
+// headerValue reads a string field from an ingest header, tolerating a missing header.
+func headerValue(header *yaml.Node, key string) string {
+	if header == nil {
+		return ""
+	}
+	if v := frontmatterField(header, key); v != nil && v.Kind == yaml.ScalarNode {
+		return v.Value
+	}
+	return ""
+}
+
+// isProvenanceField reports whether a note frontmatter field records provenance or the
+// note's place in its sequence. These fields are owned by zettelflow and survive enrich
+// unchanged.
+func isProvenanceField(key string) bool {
+	switch key {
+	case "source", "chunk", "location", "id", "parent", "prev", "next":
+		return true
+	}
+	return strings.HasPrefix(key, "source_")
+}
+
+// carryProvenance copies the provenance fields of the original note into enriched
+// frontmatter, overriding anything the enrich backend produced for them.
+func carryProvenance(original, enriched string) (string, error) {
+	originalFrontmatter, _ := splitFrontmatter(original)
+	if originalFrontmatter == "" {
+		return enriched, nil
+	}
+	from, err := parseFrontmatter(originalFrontmatter)
+	if err != nil {
+		return enriched, nil
+	}
+	to, err := parseFrontmatter(enriched)
+	if err != nil {
+		return "", err
+	}
+	carried := false
+	for i := 0; i+1 < len(from.Content); i += 2 {
+		if key := from.Content[i].Value; isProvenanceField(key) {
+			setFrontmatterField(to, key, from.Content[i+1])
+			carried = true
+		}
+	}
+	if !carried {
+		return enriched, nil
+	}
+	return marshalFrontmatter(to)
+}
+
+var excessBlankLines = regexp.MustCompile(`\n\s*\n(\s*\n)+`)
+
+// parseLocation turns the text of a location marker back into a location.
+func parseLocation(s string) sourceLocation {
+	unit, rest, _ := strings.Cut(strings.TrimSpace(s), " ")
+	start, end, _ := strings.Cut(rest, "-")
+	return sourceLocation{Unit: unit, Start: start, End: end}
+}
+
+// chunkLocator works out the source location of each chunk from the location markers
+// in the ingest output, and strips the markers from the chunk text. A chunk without a
+// marker of its own inherits the location in effect where it starts, so chunks must be
+// located in order.
+type chunkLocator struct {
+	current sourceLocation
+}
+
+// locate returns the text of the next chunk without markers, and its location.
+func (l *chunkLocator) locate(chunk string) (string, string) {
+	matches := locationMarkerPattern.FindAllStringSubmatchIndex(chunk, -1)
+	start := l.current
+	if len(matches) > 0 && strings.TrimSpace(chunk[:matches[0][0]]) == "" {
+		start = parseLocation(chunk[matches[0][2]:matches[0][3]])
+	}
+	if len(matches) > 0 {
+		last := matches[len(matches)-1]
+		l.current = parseLocation(chunk[last[2]:last[3]])
+	}
+	location := ""
+	if start.Unit != "" {
+		location = start.through(l.current).String()
+	}
+	return excessBlankLines.ReplaceAllString(locationMarkerPattern.ReplaceAllString(chunk, ""), "\n\n"), location
+}
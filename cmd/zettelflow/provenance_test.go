@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCarryProvenance(t *testing.T) {
+	original := "---\nid: 42a\nparent: \"42\"\nsource: /books/a.pdf\nsource_hash: sha256:abc\nlocation: page 3\nchunk: 2\ntitle: Old\n---\nBody\n"
+	tests := []struct {
+		name     string
+		original string
+		enriched string
+		want     map[string]string
+	}{
+		{
+			name:     "overridden",
+			original: original,
+			enriched: "id: 9z\nparent: none\nsource: made up\nsource_hash: sha256:def\nlocation: page 99\ntitle: New\ntags: [a]\n",
+			want:     map[string]string{"id": "42a", "parent": "42", "source": "/books/a.pdf", "source_hash": "sha256:abc", "location": "page 3", "chunk": "2", "title": "New"},
+		},
+		{
+			name:     "dropped",
+			original: original,
+			enriched: "title: New\n",
+			want:     map[string]string{"id": "42a", "parent": "42", "source": "/books/a.pdf", "source_hash": "sha256:abc", "location": "page 3", "title": "New"},
+		},
+		{
+			name:     "no frontmatter",
+			original: "Body\n",
+			enriched: "id: 9z\ntitle: New\n",
+			want:     map[string]string{"id": "9z", "title": "New"},
+		},
+		{
+			name:     "no provenance",
+			original: "---\ntitle: Old\n---\nBody\n",
+			enriched: "source: made up\ntitle: New\n",
+			want:     map[string]string{"source": "made up", "title": "New"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := carryProvenance(tt.original, tt.enriched)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields, err := parseFrontmatter(merged)
+			if err != nil {
+				t.Fatalf("carryProvenance() = %q: %v", merged, err)
+			}
+			for key, want := range tt.want {
+				if got := headerValue(fields, key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+
+	if _, err := carryProvenance(original, "title: [unclosed\n"); err == nil {
+		t.Error("carryProvenance() accepted invalid enriched YAML")
+	}
+}
+
+func TestChunkLocator(t *testing.T) {
+	marker := func(s string) string { return "<!-- zettelflow:location " + s + " -->\n" }
+	pieces := []struct {
+		chunk    string
+		wantText string
+		want     string
+	}{
+		{marker("location 10-12") + "The same highlight.", "The same highlight.", "location 10-12"},
+		{"A note on it.", "A note on it.", "location 10-12"},
+		{"Continued.\n\n" + marker("location 20-22") + "Another.\n\n" + marker("location 30-31") + "Third.", "Continued.\n\nAnother.\n\nThird.", "location 10-31"},
+		{marker("location 40-42") + "The same highlight.", "The same highlight.", "location 40-42"},
+		{marker("page 7") + "Elsewhere.", "Elsewhere.", "page 7"},
+	}
+	var locator chunkLocator
+	for i, p := range pieces {
+		text, location := locator.locate(p.chunk)
+		if strings.TrimSpace(text) != p.wantText || location != p.want {
+			t.Errorf("locate(chunk %d) = %q, %q, want %q, %q", i+1, text, location, p.wantText, p.want)
+		}
+	}
+
+	// Without markers, chunks have no location.
+	var plain chunkLocator
+	if _, location := plain.locate("Plain text."); location != "" {
+		t.Errorf("locate() without markers = %q, want none", location)
+	}
+}
@@ -1,18 +1,22 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
-	"time"
 
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/user/zettelflow/internal/splitter"
+	"gopkg.in/yaml.v3"
 )
 
 var splitCmd = &cobra.Command{
@@ -22,120 +26,422 @@ var splitCmd = &cobra.Command{
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		pterm.DefaultBox.WithTitle("Split Stage").Println("Starting split process...")
-		ingestPath := viper.GetString("paths.ingest")
-		if ingestPath[0] == '~' {
-			home, err := os.UserHomeDir()
-			cobra.CheckErr(err)
-			ingestPath = filepath.Join(home, ingestPath[1:])
+		_, err := splitPending(cmd)
+		cobra.CheckErr(err)
+		pterm.Success.Println("Split stage complete.")
+		os.Exit(0)
+	},
+}
+
+// splitPending splits every file waiting in the ingest directory into note stubs and
+// moves it to the processed subdirectory. It returns the paths of the notes created.
+func splitPending(cmd *cobra.Command) ([]string, error) {
+	ingestPath := expandPath(viper.GetString("paths.ingest"))
+	processedPath := filepath.Join(ingestPath, "processed")
+	if err := os.MkdirAll(processedPath, 0755); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(ingestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	namer, err := newFileNamer()
+	if err != nil {
+		return nil, err
+	}
+	strategy, err := newSplitStrategy(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	filesToProcess := []os.FileInfo{}
+	for _, file := range files {
+		if !file.IsDir() && !strings.HasPrefix(file.Name(), ".") {
+			filesToProcess = append(filesToProcess, file)
 		}
-		processedPath := filepath.Join(ingestPath, "processed")
-		cobra.CheckErr(os.MkdirAll(processedPath, 0755))
+	}
 
-		files, err := ioutil.ReadDir(ingestPath)
-		cobra.CheckErr(err)
+	if len(filesToProcess) == 0 {
+		pterm.Info.Println("No files to split in the ingest directory.")
+		return nil, nil
+	}
+
+	tmpl, err := loadNoteTemplate(templateName(cmd))
+	if err != nil {
+		return nil, err
+	}
+	run := &splitRun{
+		tmpl:       tmpl,
+		namer:      namer,
+		splitPath:  expandPath(viper.GetString("paths.split")),
+		enrichPath: expandPath(viper.GetString("paths.enrich")),
+		ext:        viper.GetString("split.output_extension"),
+		structure:  viper.GetBool("split.structure_note"),
+	}
+	run.preview, _ = cmd.Flags().GetBool("preview")
+	if cmd.Flags().Changed("structure-note") {
+		run.structure, _ = cmd.Flags().GetBool("structure-note")
+	}
+	interactive, _ := cmd.Flags().GetBool("interactive")
+	stream, _ := cmd.Flags().GetBool("stream")
+	if stream && interactive {
+		return nil, errors.New("--stream and --interactive cannot be combined: reviewing needs all chunks of a file")
+	}
+	if stream && strategy.delimiter == "" {
+		return nil, fmt.Errorf("--stream needs the delimiter strategy, not %s", strategy.spec)
+	}
+	streamSize := int64(viper.GetFloat64("split.stream_threshold_mb") * 1024 * 1024)
+	if !run.preview {
+		if run.journal, err = newJournal("split"); err != nil {
+			return nil, err
+		}
+		pterm.Debug.Printf("Recording run %s in %s\n", run.journal.ID, run.journal.path)
+	}
 
-		filesToProcess := []os.FileInfo{}
-		for _, file := range files {
-			if !file.IsDir() {
-				filesToProcess = append(filesToProcess, file)
+	for _, file := range filesToProcess {
+		inputFile := filepath.Join(ingestPath, file.Name())
+
+		pterm.Info.Printf("Splitting file: %s by strategy: '%s'\n", file.Name(), strategy.spec)
+
+		streamFile := stream
+		if !stream && streamSize > 0 && file.Size() > streamSize {
+			switch {
+			case strategy.delimiter == "":
+				pterm.Warning.Printf("%s is large; only the delimiter strategy can split it without reading it whole.\n", file.Name())
+			case interactive:
+				pterm.Warning.Printf("%s is large, but is read whole for --interactive.\n", file.Name())
+			default:
+				streamFile = true
 			}
 		}
+		var hash string
+		if streamFile {
+			pterm.Debug.Printf("Streaming %s (%d bytes).\n", file.Name(), file.Size())
+			hash, err = run.splitStreaming(inputFile, strategy.delimiter)
+		} else {
+			hash, err = run.splitWhole(inputFile, strategy.split, interactive)
+		}
+		if errors.Is(err, errReviewSkipped) {
+			pterm.Warning.Printf("Skipped %s; it stays in the ingest directory.\n", file.Name())
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
 
-		if len(filesToProcess) == 0 {
-			pterm.Info.Println("No files to split in the ingest directory.")
-			os.Exit(0)
+		// Move the processed file
+		if !run.preview {
+			destPath := filepath.Join(processedPath, file.Name())
+			pterm.Debug.Printf("  - Moving processed file to: %s\n", destPath)
+			err = os.Rename(inputFile, destPath)
+			if err != nil {
+				return nil, err
+			}
+			if err := run.journal.moved(inputFile, destPath, hash); err != nil {
+				return nil, err
+			}
 		}
+	}
+	return run.created, nil
+}
 
-		for _, file := range filesToProcess {
-			inputFile := filepath.Join(ingestPath, file.Name())
-			delimiter, _ := cmd.Flags().GetString("delimiter")
-			preview, _ := cmd.Flags().GetBool("preview")
+// splitWhole reads a file into memory and splits it. Its chunks can be reviewed before
+// any note is written. It returns the hash of the file.
+func (r *splitRun) splitWhole(path string, split func(string) ([]string, error), interactive bool) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
 
-			pterm.Info.Printf("Splitting file: %s by delimiter: '%s'\n", file.Name(), delimiter)
+	// The provenance header written by ingest is metadata, not note content.
+	header, body := splitIngestHeader(string(content))
+	pieces, err := split(body)
+	if err != nil {
+		return "", err
+	}
+	pterm.Debug.Printf("Found %d chunks.\n", len(pieces))
 
-			content, err := ioutil.ReadFile(inputFile)
-			cobra.CheckErr(err)
+	var locator chunkLocator
+	var proposed []proposedChunk
+	for _, piece := range pieces {
+		if chunk, ok := newProposedChunk(locator.locate(piece)); ok {
+			proposed = append(proposed, chunk)
+		}
+	}
+	if interactive && len(proposed) > 0 {
+		if proposed, err = reviewChunks(filepath.Base(path), proposed); err != nil {
+			return "", err
+		}
+	}
 
-			chunks := strings.Split(string(content), delimiter)
-			pterm.Debug.Printf("Found %d chunks.\n", len(chunks))
+	sequence, err := r.newSequence(header, firstNonEmpty(headerValue(header, "source_hash"), hashContent([]byte(body))), len(proposed))
+	if err != nil {
+		return "", err
+	}
+	for _, chunk := range proposed {
+		if err := sequence.add(chunk); err != nil {
+			return "", err
+		}
+	}
+	return hashContent(content), sequence.finish()
+}
 
-			// Load and parse the YAML template
-			templatePath := viper.GetString("paths.templates")
-			if templatePath[0] == '~' {
-				home, err := os.UserHomeDir()
-				cobra.CheckErr(err)
-				templatePath = filepath.Join(home, templatePath[1:])
-			}
-			templatePath = filepath.Join(templatePath, "note_header.yml")
-			templateBytes, err := ioutil.ReadFile(templatePath)
-			cobra.CheckErr(err)
-
-			funcMap := template.FuncMap{
-				"join": func(sep string, a []string) string {
-					return strings.Join(a, sep)
-				},
-			}
+// splitStreaming splits a file at a delimiter as it reads it, and writes each note as
+// soon as the next one is found, so that a large file is never held in memory. The
+// number of notes (.Chunks) is not known to the template. It returns the hash of the file.
+func (r *splitRun) splitStreaming(path, delimiter string) (string, error) {
+	// Hashing first lets new sources get their Folgezettel number before the first note.
+	hash, err := hashFile(path)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
 
-			tmpl, err := template.New("note").Funcs(funcMap).Parse(string(templateBytes))
-			cobra.CheckErr(err)
+	header, body, err := readIngestHeader(bufio.NewReader(f))
+	if err != nil {
+		return "", err
+	}
+	sequence, err := r.newSequence(header, firstNonEmpty(headerValue(header, "source_hash"), hash), 0)
+	if err != nil {
+		return "", err
+	}
+	var locator chunkLocator
+	chunks := 0
+	err = splitter.DelimiterStream(body, delimiter, func(piece string) error {
+		chunks++
+		if chunk, ok := newProposedChunk(locator.locate(piece)); ok {
+			return sequence.add(chunk)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	pterm.Debug.Printf("Found %d chunks.\n", chunks)
+	return hash, sequence.finish()
+}
 
-			splitPath := viper.GetString("paths.split")
-			if splitPath[0] == '~' {
-				home, err := os.UserHomeDir()
-				cobra.CheckErr(err)
-				splitPath = filepath.Join(home, splitPath[1:])
-			}
+// newProposedChunk trims the text of a chunk and, under split.clean, tidies it. It
+// reports false if nothing is left.
+func newProposedChunk(text, location string) (proposedChunk, bool) {
+	text = strings.TrimSpace(text)
+	if viper.GetBool("split.clean") {
+		text = splitter.Clean(text)
+	}
+	return proposedChunk{Text: text, Location: location}, text != ""
+}
 
-			type NoteData struct {
-				Content string
-				Date    string
-				Title   string
-				Tags    []string
-			}
+// templateName returns the note template chosen with --template or split.template.
+func templateName(cmd *cobra.Command) string {
+	if cmd.Flags().Changed("template") {
+		name, _ := cmd.Flags().GetString("template")
+		return name
+	}
+	return viper.GetString("split.template")
+}
 
-			for i, chunk := range chunks {
-				chunk = strings.TrimSpace(chunk)
-				if chunk == "" {
-					continue
-				}
-
-				data := NoteData{
-					Content: chunk,
-					Date:    time.Now().Format("2006-01-02"),
-				}
-
-				var buf bytes.Buffer
-				err := tmpl.Execute(&buf, data)
-				cobra.CheckErr(err)
-
-				if preview {
-                    pterm.NewStyle(pterm.FgLightCyan, pterm.Bold).Printf("--- Chunk %d Preview ---\n", i+1)
-                    pterm.Println(buf.String())
-                } else {
-					ts := time.Now().Format("20060102150405")
-					outputFile := filepath.Join(splitPath, fmt.Sprintf("note_%s_%d%s", ts, i+1, viper.GetString("split.output_extension")))
-					err = ioutil.WriteFile(outputFile, buf.Bytes(), 0644)
-					cobra.CheckErr(err)
-					pterm.Success.Printf("  - Created note: %s\n", outputFile)
-				}
-			}
+// splitStrategy is the chunking strategy of a run.
+type splitStrategy struct {
+	split     func(string) ([]string, error)
+	spec      string // for display
+	delimiter string // set for the delimiter strategy, which can also split a stream
+}
 
-			// Move the processed file
-			if !preview {
-				destPath := filepath.Join(processedPath, file.Name())
-				pterm.Debug.Printf("  - Moving processed file to: %s\n", destPath)
-				err = os.Rename(inputFile, destPath)
-				cobra.CheckErr(err)
-			}
+// newSplitStrategy builds the chunking strategy from --strategy and --delimiter, falling
+// back to split.strategy and the split.* options of the configuration. The semantic
+// strategy needs the LLM, so unlike the strategies of the splitter package it can fail.
+func newSplitStrategy(cmd *cobra.Command) (splitStrategy, error) {
+	spec := viper.GetString("split.strategy")
+	if cmd.Flags().Changed("strategy") {
+		spec, _ = cmd.Flags().GetString("strategy")
+	}
+	if name, method, _ := strings.Cut(spec, ":"); name == "semantic" {
+		preview, _ := cmd.Flags().GetBool("preview")
+		semantic, err := newSemanticSplitter(method, preview)
+		if err != nil {
+			return splitStrategy{}, err
 		}
-		pterm.Success.Println("Split stage complete.")
-		os.Exit(0)
-	},
+		return splitStrategy{split: semantic.split, spec: "semantic:" + semantic.method}, nil
+	}
+	opts := splitter.Options{
+		Delimiter:    viper.GetString("split.delimiter"),
+		HeadingLevel: viper.GetInt("split.heading_level"),
+		Sentences:    viper.GetInt("split.sentences"),
+		MaxTokens:    viper.GetInt("split.max_tokens"),
+		Overlap:      viper.GetInt("split.overlap"),
+		Pattern:      viper.GetString("split.pattern"),
+	}
+	if cmd.Flags().Changed("delimiter") {
+		opts.Delimiter, _ = cmd.Flags().GetString("delimiter")
+	}
+	split, err := splitter.New(spec, opts)
+	if err != nil {
+		return splitStrategy{}, err
+	}
+	strategy := splitStrategy{
+		split: func(text string) ([]string, error) { return split(text), nil },
+		spec:  spec,
+	}
+	if name, arg, hasArg := strings.Cut(strings.TrimSpace(spec), ":"); name == "" || name == "delimiter" {
+		strategy.delimiter = opts.Delimiter
+		if hasArg {
+			strategy.delimiter = arg
+		}
+		strategy.spec = "delimiter:" + strategy.delimiter
+	}
+	return strategy, nil
+}
+
+// NoteData is the data available to the note template.
+type NoteData struct {
+	Content string
+	Date    string
+	Title   string
+	Tags    []string
+
+	// The note's ID, that of the note it belongs under and those of the notes cut before
+	// and after it from the same source, under split.ids: file names without extension,
+	// or Folgezettel numbers. The first note has no PrevID and the last no NextID; notes
+	// directly under the source have its Folgezettel number as Parent, or none.
+	ID     string
+	Parent string
+	PrevID string
+	NextID string
+
+	// Wikilinks to the parent, previous and next notes, e.g. [[note_20240501093012_2|42b]],
+	// and all three as a navigation line: "← [[…]] · ↑ [[…]] · [[…]] →".
+	ParentLink string
+	PrevLink   string
+	NextLink   string
+	Nav        string
+
+	// Provenance of the chunk, taken from the ingest header.
+	Source         string
+	SourceHash     string
+	SourceTitle    string
+	SourceVersion  string
+	SourceModified string
+	SourceMeta     map[string]string // the other source_* fields, e.g. author, without the prefix
+	IngestedAt     string
+	Model          string // empty for raw ingests
+	Prompt         string
+	Chunk          int // position of the note among those cut from the source, from 1
+	Chunks         int // number of notes cut from the source; 0 when the source is streamed
+	Location       string
+}
+
+// sourceNoteData fills in the provenance fields of the note data from an ingest header.
+func sourceNoteData(header *yaml.Node) NoteData {
+	data := NoteData{
+		Source:         headerValue(header, "source"),
+		SourceHash:     headerValue(header, "source_hash"),
+		SourceTitle:    headerValue(header, "source_title"),
+		SourceVersion:  headerValue(header, "source_version"),
+		SourceModified: headerValue(header, "source_mtime"),
+		SourceMeta:     map[string]string{},
+		IngestedAt:     headerValue(header, "ingested_at"),
+		Model:          headerValue(header, "model"),
+		Prompt:         headerValue(header, "prompt"),
+	}
+	if header == nil {
+		return data
+	}
+	for i := 0; i+1 < len(header.Content); i += 2 {
+		key := header.Content[i].Value
+		switch key {
+		case "source_hash", "source_title", "source_version", "source_mtime":
+			continue
+		}
+		if meta, ok := strings.CutPrefix(key, "source_"); ok && header.Content[i+1].Kind == yaml.ScalarNode {
+			data.SourceMeta[meta] = header.Content[i+1].Value
+		}
+	}
+	return data
+}
+
+// renderNote executes the note template. Templates written before split filled in
+// titles render {{ .Title }} unquoted, which breaks the frontmatter for titles such as
+// "Note: …"; such titles are rendered again as quoted YAML scalars.
+func renderNote(tmpl *template.Template, data NoteData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	frontmatter, _ := splitFrontmatter(buf.String())
+	if data.Title == "" || frontmatter == "" {
+		return buf.String(), nil
+	}
+	if _, err := parseFrontmatter(frontmatter); err == nil {
+		return buf.String(), nil
+	}
+	data.Title = yamlScalar(data.Title)
+	buf.Reset()
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ensureProvenance adds the provenance and sequence fields to a rendered note whose
+// template does not emit them itself, so that notes keep their source and place even
+// with older custom templates.
+func ensureProvenance(rendered string, data NoteData) (string, error) {
+	frontmatter, body := splitFrontmatter(rendered)
+	if frontmatter == "" && !strings.HasPrefix(rendered, "---") {
+		return rendered, nil
+	}
+	fields, err := parseFrontmatter(frontmatter)
+	if err != nil {
+		return "", err
+	}
+	changed := false
+	if data.Source != "" && frontmatterField(fields, "source") == nil {
+		setFrontmatterField(fields, "source", stringNode(data.Source))
+		setFrontmatterField(fields, "source_hash", stringNode(data.SourceHash))
+		setFrontmatterField(fields, "chunk", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(data.Chunk)})
+		if data.Location != "" {
+			setFrontmatterField(fields, "location", stringNode(data.Location))
+		}
+		changed = true
+	}
+	for _, f := range []struct{ key, value string }{{"id", data.ID}, {"parent", data.Parent}, {"prev", data.PrevID}, {"next", data.NextID}} {
+		if f.value != "" && frontmatterField(fields, f.key) == nil {
+			setFrontmatterField(fields, f.key, stringNode(f.value))
+			changed = true
+		}
+	}
+	if !changed {
+		return rendered, nil
+	}
+	out, err := marshalFrontmatter(fields)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("---\n%s\n---\n%s", out, body), nil
+}
+
+// yamlScalar renders a value as an inline YAML scalar, quoting it when needed.
+func yamlScalar(v interface{}) string {
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
 }
 
 func init() {
 	rootCmd.AddCommand(splitCmd)
-	splitCmd.Flags().StringP("delimiter", "d", "###", "The delimiter to split the file by")
+	splitCmd.Flags().StringP("delimiter", "d", "###", "The delimiter to split the file by (default split.delimiter)")
+	splitCmd.Flags().StringP("strategy", "s", "", "How to cut files into notes: "+strings.Join(append(splitter.Names(), "semantic"), ", ")+", optionally with a parameter, e.g. heading:2 (default split.strategy)")
+	splitCmd.Flags().StringP("template", "t", "", "Note template: the name of a template in the templates directory, or a file path (default split.template)")
+	splitCmd.Flags().Bool("structure-note", false, "Also write a structure note linking the notes of each file (default split.structure_note)")
+	splitCmd.Flags().BoolP("interactive", "i", false, "Review the chunks of each file before writing: accept, retitle, merge, split or drop them")
+	splitCmd.Flags().Bool("stream", false, "Split every file as it is read, writing notes as they are found; delimiter strategy only (default: files over split.stream_threshold_mb)")
 	splitCmd.Flags().Bool("preview", false, "Preview the split without writing files")
 }
-
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// idSchemes are the accepted values of split.ids.
+var idSchemes = []string{"file", "folgezettel"}
+
+// noteTree works out the hierarchy of the notes cut from one source, one note at a time,
+// from the levels of their leading headings (0 for none). A note's parent is the closest
+// earlier note with a higher-level heading; a note without a heading continues at the
+// level of the note before it.
+type noteTree struct {
+	count int
+	last  int // parent of the latest note
+	stack []openHeading
+}
+
+type openHeading struct{ index, level int }
+
+// add places the next note and returns the index of its parent, or -1 for the notes
+// directly under the source.
+func (t *noteTree) add(level int) int {
+	i := t.count
+	t.count++
+	if level == 0 {
+		if i == 0 {
+			t.last = -1
+		}
+		return t.last
+	}
+	for len(t.stack) > 0 && t.stack[len(t.stack)-1].level >= level {
+		t.stack = t.stack[:len(t.stack)-1]
+	}
+	t.last = -1
+	if len(t.stack) > 0 {
+		t.last = t.stack[len(t.stack)-1].index
+	}
+	t.stack = append(t.stack, openHeading{i, level})
+	return t.last
+}
+
+// noteIDs hands out the IDs of the notes of one source under split.ids: their file
+// names, or Folgezettel numbers in the manner of Luhmann's Zettelkasten. There, the
+// source gets a number, root, the notes under it are root+"a", root+"b", …, their
+// children add a number ("42a1", "42a2"), the next level a letter again, and so on.
+type noteIDs struct {
+	folgezettel bool
+	sourceHash  string
+	preview     bool
+
+	root     string // the source's number, given when the first note is numbered
+	ids      []string
+	depths   []int
+	children map[int]int // parent index (-1 for the root) to the children numbered so far
+}
+
+// newNoteIDs starts numbering the notes of the source with the given hash. A preview does
+// not record the number given to a new source.
+func newNoteIDs(sourceHash string, preview bool) (*noteIDs, error) {
+	n := &noteIDs{sourceHash: sourceHash, preview: preview, children: map[int]int{}}
+	switch scheme := strings.ToLower(viper.GetString("split.ids")); scheme {
+	case "", "file":
+	case "folgezettel":
+		n.folgezettel = true
+	default:
+		return nil, fmt.Errorf("unknown split.ids %q (expected one of %s)", scheme, strings.Join(idSchemes, ", "))
+	}
+	return n, nil
+}
+
+// next returns the ID of the next note, stored as file, under the note with index parent
+// (-1 for the source).
+func (n *noteIDs) next(file string, parent int) (string, error) {
+	id := file
+	if n.folgezettel {
+		if n.root == "" {
+			numbers, err := loadFolgezettelNumbers()
+			if err != nil {
+				return "", err
+			}
+			number, err := numbers.number(n.sourceHash, !n.preview)
+			if err != nil {
+				return "", err
+			}
+			n.root = strconv.Itoa(number)
+		}
+		n.children[parent]++
+		parentID, depth := n.root, 1
+		if parent >= 0 {
+			parentID, depth = n.ids[parent], n.depths[parent]+1
+		}
+		if depth%2 == 1 {
+			id = parentID + letterSequence(n.children[parent])
+		} else {
+			id = parentID + strconv.Itoa(n.children[parent])
+		}
+		n.depths = append(n.depths, depth)
+	}
+	n.ids = append(n.ids, id)
+	return id, nil
+}
+
+// letterSequence returns the n-th (from 1) of a, b, …, z, aa, ab, …
+func letterSequence(n int) string {
+	var out []byte
+	for ; n > 0; n = (n - 1) / 26 {
+		out = append([]byte{byte('a' + (n-1)%26)}, out...)
+	}
+	return string(out)
+}
+
+// wikilink links to the note stored as file, showing its ID if that differs.
+func wikilink(file, id string) string {
+	if file == "" {
+		return ""
+	}
+	if id == "" || id == file {
+		return "[[" + file + "]]"
+	}
+	return "[[" + file + "|" + id + "]]"
+}
+
+// navLine joins the links of a note to its neighbours into one line.
+func navLine(data NoteData) string {
+	var parts []string
+	if data.PrevLink != "" {
+		parts = append(parts, "← "+data.PrevLink)
+	}
+	if data.ParentLink != "" {
+		parts = append(parts, "↑ "+data.ParentLink)
+	}
+	if data.NextLink != "" {
+		parts = append(parts, data.NextLink+" →")
+	}
+	return strings.Join(parts, " · ")
+}
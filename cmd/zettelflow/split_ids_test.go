@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestNoteTreeAndIDs(t *testing.T) {
+	tests := []struct {
+		name        string
+		levels      []int
+		wantParents []int
+		wantIDs     []string
+	}{
+		{
+			name:        "siblings and a heading-less note",
+			levels:      []int{1, 2, 2, 0, 1, 3},
+			wantParents: []int{-1, 0, 0, 0, -1, 4},
+			wantIDs:     []string{"42a", "42a1", "42a2", "42a3", "42b", "42b1"},
+		},
+		{
+			name:        "alternating depth",
+			levels:      []int{1, 2, 3, 4, 5},
+			wantParents: []int{-1, 0, 1, 2, 3},
+			wantIDs:     []string{"42a", "42a1", "42a1a", "42a1a1", "42a1a1a"},
+		},
+		{
+			name:        "no headings",
+			levels:      []int{0, 0, 0},
+			wantParents: []int{-1, -1, -1},
+			wantIDs:     []string{"42a", "42b", "42c"},
+		},
+		{
+			name:        "heading-less notes continue at the previous level",
+			levels:      []int{2, 3, 0, 0, 2, 0},
+			wantParents: []int{-1, 0, 0, 0, -1, -1},
+			wantIDs:     []string{"42a", "42a1", "42a2", "42a3", "42b", "42c"},
+		},
+		{
+			name:        "skipped levels",
+			levels:      []int{3, 1, 4, 2},
+			wantParents: []int{-1, -1, 1, 1},
+			wantIDs:     []string{"42a", "42b", "42b1", "42b2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testConfig(t)
+			viper.Set("split.ids", "folgezettel")
+			viper.Set("split.folgezettel_start", 42)
+			ids, err := newNoteIDs("sha256:source", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var tree noteTree
+			var parents []int
+			var got []string
+			for i, level := range tt.levels {
+				parent := tree.add(level)
+				id, err := ids.next(fmt.Sprintf("note-%d", i), parent)
+				if err != nil {
+					t.Fatal(err)
+				}
+				parents = append(parents, parent)
+				got = append(got, id)
+			}
+			if fmt.Sprint(parents) != fmt.Sprint(tt.wantParents) {
+				t.Errorf("parents = %v, want %v", parents, tt.wantParents)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.wantIDs, " ") {
+				t.Errorf("IDs = %q, want %q", got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestNoteIDsFile(t *testing.T) {
+	testConfig(t)
+	ids, err := newNoteIDs("sha256:source", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := ids.next("note_1", -1); err != nil || id != "note_1" {
+		t.Errorf("next() = %q, %v, want the file name", id, err)
+	}
+	viper.Set("split.ids", "luhmann")
+	if _, err := newNoteIDs("sha256:source", false); err == nil {
+		t.Error("newNoteIDs() accepted an unknown split.ids")
+	}
+}
+
+func TestLetterSequence(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{1, "a"},
+		{2, "b"},
+		{26, "z"},
+		{27, "aa"},
+		{28, "ab"},
+		{52, "az"},
+		{53, "ba"},
+		{702, "zz"},
+		{703, "aaa"},
+	}
+	for _, tt := range tests {
+		if got := letterSequence(tt.n); got != tt.want {
+			t.Errorf("letterSequence(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// proposedChunk is a chunk on its way to becoming a note. Title, if set, replaces the
+// title split would derive from the text.
+type proposedChunk struct {
+	Text     string
+	Location string
+	Title    string
+}
+
+// errReviewSkipped reports that the user chose to leave a file unsplit.
+var errReviewSkipped = errors.New("file skipped during review")
+
+// Review actions, as offered for every chunk.
+const (
+	reviewAccept    = "Accept"
+	reviewTitle     = "Edit title"
+	reviewMerge     = "Merge with next"
+	reviewSplit     = "Split at line"
+	reviewDrop      = "Drop"
+	reviewAcceptAll = "Accept this and all remaining"
+	reviewSkip      = "Skip file (write nothing, keep it in ingest)"
+)
+
+// reviewChunks walks the user through the chunks proposed for a file. Each chunk can be
+// accepted, retitled, merged with the next, split in two at a line, or dropped. It
+// returns the approved chunks, or errReviewSkipped if the file should be left alone.
+func reviewChunks(name string, chunks []proposedChunk) ([]proposedChunk, error) {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil, errors.New("--interactive needs a terminal")
+	}
+	var approved []proposedChunk
+	for i := 0; i < len(chunks); {
+		c := chunks[i]
+		showChunk(name, c, i, len(chunks))
+
+		options := []string{reviewAccept, reviewTitle}
+		if i+1 < len(chunks) {
+			options = append(options, reviewMerge)
+		}
+		if len(chunkLines(c.Text)) > 1 {
+			options = append(options, reviewSplit)
+		}
+		options = append(options, reviewDrop, reviewAcceptAll, reviewSkip)
+		action, err := pterm.DefaultInteractiveSelect.WithOptions(options).WithDefaultText("Chunk").Show()
+		if err != nil {
+			return nil, err
+		}
+
+		switch action {
+		case reviewAccept:
+			approved = append(approved, c)
+			i++
+		case reviewTitle:
+			title, err := pterm.DefaultInteractiveTextInput.WithDefaultValue(chunkTitle(c)).Show("Title")
+			if err != nil {
+				return nil, err
+			}
+			chunks[i].Title = strings.TrimSpace(title)
+		case reviewMerge:
+			chunks = mergeChunks(chunks, i)
+		case reviewSplit:
+			input, err := pterm.DefaultInteractiveTextInput.Show(fmt.Sprintf("Start the second note at line (2-%d)", len(chunkLines(c.Text))))
+			if err != nil {
+				return nil, err
+			}
+			line, err := strconv.Atoi(strings.TrimSpace(input))
+			if split, ok := splitChunk(chunks, i, line); err == nil && ok {
+				chunks = split
+			} else {
+				pterm.Warning.Printf("Not a line to split at: %q\n", input)
+			}
+		case reviewDrop:
+			i++
+		case reviewAcceptAll:
+			return append(approved, chunks[i:]...), nil
+		case reviewSkip:
+			return nil, errReviewSkipped
+		}
+	}
+	return approved, nil
+}
+
+// showChunk prints a chunk with numbered lines, for the user to decide on.
+func showChunk(name string, c proposedChunk, i, n int) {
+	var body strings.Builder
+	for number, line := range chunkLines(c.Text) {
+		fmt.Fprintf(&body, "%s %s\n", pterm.Gray(fmt.Sprintf("%3d", number+1)), line)
+	}
+	title := fmt.Sprintf("%s · chunk %d of %d · %s", name, i+1, n, chunkTitle(c))
+	if c.Location != "" {
+		title += " · " + c.Location
+	}
+	pterm.DefaultBox.WithTitle(title).Println(strings.TrimRight(body.String(), "\n"))
+}
+
+// chunkTitle returns the title the chunk's note will get.
+func chunkTitle(c proposedChunk) string {
+	if c.Title != "" {
+		return c.Title
+	}
+	title, _, _ := noteFields(c.Text)
+	return firstNonEmpty(title, deriveTitle(c.Text))
+}
+
+func chunkLines(text string) []string {
+	return strings.Split(text, "\n")
+}
+
+// mergeChunks joins chunk i and the one after it into one, which spans the locations of
+// both and keeps any title of the first.
+func mergeChunks(chunks []proposedChunk, i int) []proposedChunk {
+	merged := chunks[i]
+	merged.Text = strings.TrimSpace(merged.Text) + "\n\n" + strings.TrimSpace(chunks[i+1].Text)
+	if merged.Location == "" {
+		merged.Location = chunks[i+1].Location
+	} else if next := chunks[i+1].Location; next != "" {
+		merged.Location = parseLocation(merged.Location).through(parseLocation(next)).String()
+	}
+	out := append([]proposedChunk{}, chunks[:i]...)
+	out = append(out, merged)
+	return append(out, chunks[i+2:]...)
+}
+
+// splitChunk cuts chunk i in two before the given line (numbered from 1). Both parts
+// keep the location; a title set for the chunk stays with the first. It reports false if
+// either part would be empty.
+func splitChunk(chunks []proposedChunk, i, line int) ([]proposedChunk, bool) {
+	lines := chunkLines(chunks[i].Text)
+	if line < 2 || line > len(lines) {
+		return chunks, false
+	}
+	first := strings.TrimSpace(strings.Join(lines[:line-1], "\n"))
+	second := strings.TrimSpace(strings.Join(lines[line-1:], "\n"))
+	if first == "" || second == "" {
+		return chunks, false
+	}
+	out := append([]proposedChunk{}, chunks[:i]...)
+	out = append(out,
+		proposedChunk{Text: first, Location: chunks[i].Location, Title: chunks[i].Title},
+		proposedChunk{Text: second, Location: chunks[i].Location},
+	)
+	return append(out, chunks[i+1:]...), true
+}
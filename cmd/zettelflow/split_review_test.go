@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeChunks(t *testing.T) {
+	chunks := []proposedChunk{
+		{Text: "One\n", Location: "page 1", Title: "First"},
+		{Text: "Two", Location: "page 2-3"},
+		{Text: "Three", Location: "page 4"},
+		{Text: "Four"},
+		{Text: "Five", Location: "location 10-12"},
+	}
+	tests := []struct {
+		name string
+		i    int
+		want []proposedChunk
+	}{
+		{"first", 0, []proposedChunk{
+			{Text: "One\n\nTwo", Location: "page 1-3", Title: "First"},
+			chunks[2], chunks[3], chunks[4],
+		}},
+		{"without location", 2, []proposedChunk{
+			chunks[0], chunks[1],
+			{Text: "Three\n\nFour", Location: "page 4"},
+			chunks[4],
+		}},
+		{"last", 3, []proposedChunk{
+			chunks[0], chunks[1], chunks[2],
+			{Text: "Four\n\nFive", Location: "location 10-12"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := append([]proposedChunk{}, chunks...)
+			if got := mergeChunks(input, tt.i); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeChunks(%d) = %+v, want %+v", tt.i, got, tt.want)
+			}
+			if !reflect.DeepEqual(input, chunks) {
+				t.Errorf("mergeChunks(%d) changed its input to %+v", tt.i, input)
+			}
+		})
+	}
+}
+
+func TestSplitChunk(t *testing.T) {
+	chunks := []proposedChunk{
+		{Text: "Before"},
+		{Text: "# Title\nFirst line\n\nLast line", Location: "page 7", Title: "Set"},
+		{Text: "After"},
+	}
+	tests := []struct {
+		name   string
+		line   int
+		want   []proposedChunk
+		wantOK bool
+	}{
+		{"middle", 3, []proposedChunk{
+			chunks[0],
+			{Text: "# Title\nFirst line", Location: "page 7", Title: "Set"},
+			{Text: "Last line", Location: "page 7"},
+			chunks[2],
+		}, true},
+		{"second line", 2, []proposedChunk{
+			chunks[0],
+			{Text: "# Title", Location: "page 7", Title: "Set"},
+			{Text: "First line\n\nLast line", Location: "page 7"},
+			chunks[2],
+		}, true},
+		{"last line", 4, []proposedChunk{
+			chunks[0],
+			{Text: "# Title\nFirst line", Location: "page 7", Title: "Set"},
+			{Text: "Last line", Location: "page 7"},
+			chunks[2],
+		}, true},
+		{"first line", 1, chunks, false},
+		{"past the end", 5, chunks, false},
+		{"line zero", 0, chunks, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := splitChunk(chunks, 1, tt.line)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitChunk(%d) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// A split that leaves only blank lines on one side is refused.
+	blank := []proposedChunk{{Text: "Text\n\n"}}
+	if _, ok := splitChunk(blank, 0, 3); ok {
+		t.Error("splitChunk() split off an empty note")
+	}
+}
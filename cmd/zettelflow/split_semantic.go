@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pterm/pterm"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/viper"
+	"github.com/user/zettelflow"
+	"github.com/user/zettelflow/internal/splitter"
+)
+
+// semanticBoundary is a cut point found by the semantic strategy: a new idea starts with
+// sentence Before (numbered from 1).
+type semanticBoundary struct {
+	Before int    `json:"before"`
+	Reason string `json:"reason"`
+}
+
+// semanticSplitter cuts text where its ideas change, as judged by the LLM or by drops
+// in the embedding similarity of neighbouring sentences. The text itself is never sent
+// back through the model: chunks are slices of the original sentences.
+type semanticSplitter struct {
+	method  string // "llm" or "embeddings"
+	preview bool
+	client  *openai.Client
+}
+
+// newSemanticSplitter reads the split.semantic settings.
+func newSemanticSplitter(method string, preview bool) (*semanticSplitter, error) {
+	if method == "" {
+		method = viper.GetString("split.semantic.method")
+	}
+	if method != "llm" && method != "embeddings" {
+		return nil, fmt.Errorf("semantic strategy: unknown method %q (expected llm or embeddings)", method)
+	}
+	checkAPIKey()
+	return &semanticSplitter{method: method, preview: preview, client: openai.NewClient(viper.GetString("llm.api_key"))}, nil
+}
+
+// split returns the chunks of text, cut at the boundaries the method found.
+func (s *semanticSplitter) split(text string) ([]string, error) {
+	sentences := splitter.Sentences(text, 1)
+	if len(sentences) < 2 {
+		return sentences, nil
+	}
+	// Location markers are provenance, not content; the model should not see them.
+	plain := make([]string, len(sentences))
+	for i, sentence := range sentences {
+		plain[i] = strings.Join(strings.Fields(locationMarkerPattern.ReplaceAllString(sentence, "")), " ")
+	}
+
+	var boundaries []semanticBoundary
+	var err error
+	if s.method == "embeddings" {
+		boundaries, err = s.embeddingBoundaries(plain)
+	} else {
+		boundaries, err = s.llmBoundaries(plain)
+	}
+	if err != nil {
+		return nil, err
+	}
+	boundaries = cleanBoundaries(boundaries, len(sentences))
+	s.report(plain, boundaries)
+
+	var chunks []string
+	start := 0
+	for _, b := range boundaries {
+		chunks = append(chunks, strings.Join(sentences[start:b.Before-1], ""))
+		start = b.Before - 1
+	}
+	return append(chunks, strings.Join(sentences[start:], "")), nil
+}
+
+// llmBoundaries sends the numbered sentences to the LLM, in parts of at most
+// ingest.max_input_chars characters, and collects the boundaries it names.
+func (s *semanticSplitter) llmBoundaries(sentences []string) ([]semanticBoundary, error) {
+	prompt, err := splitPrompt()
+	if err != nil {
+		return nil, err
+	}
+	model := viper.GetString("split.semantic.model")
+	if model == "" {
+		return nil, errors.New("split.semantic.model is not defined in the configuration")
+	}
+	maxChars := viper.GetInt("ingest.max_input_chars")
+
+	var boundaries []semanticBoundary
+	for start := 0; start < len(sentences); {
+		var numbered strings.Builder
+		end := start
+		for end < len(sentences) && (end == start || numbered.Len()+len(sentences[end]) < maxChars) {
+			fmt.Fprintf(&numbered, "[%d] %s\n", end+1, sentences[end])
+			end++
+		}
+		if end < len(sentences) || start > 0 {
+			pterm.Info.Printf("Finding idea boundaries in sentences %d-%d of %d...\n", start+1, end, len(sentences))
+		} else {
+			pterm.Info.Println("Finding idea boundaries...")
+		}
+		resp, err := s.client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+			Model:               model,
+			Temperature:         0,
+			MaxCompletionTokens: viper.GetInt("ingest.max_completion_tokens"),
+			Messages: []openai.ChatCompletionMessage{{
+				Role:    openai.ChatMessageRoleUser,
+				Content: strings.Replace(prompt, "{sentences}", numbered.String(), -1),
+			}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Choices) == 0 {
+			return nil, errors.New("the LLM returned no choices")
+		}
+		found, err := parseBoundaries(resp.Choices[0].Message.Content)
+		if err != nil {
+			return nil, err
+		}
+		boundaries = append(boundaries, found...)
+		// A part ends where the next begins, which is also a cut point.
+		if end < len(sentences) {
+			boundaries = append(boundaries, semanticBoundary{Before: end + 1, Reason: "end of an LLM request (ingest.max_input_chars)"})
+		}
+		start = end
+	}
+	return boundaries, nil
+}
+
+// parseBoundaries reads the JSON answer of the split prompt, tolerating text or code
+// fences around it.
+func parseBoundaries(response string) ([]semanticBoundary, error) {
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("no JSON in the LLM response: %q", response)
+	}
+	var answer struct {
+		Boundaries []semanticBoundary `json:"boundaries"`
+	}
+	if err := json.Unmarshal([]byte(response[start:end+1]), &answer); err != nil {
+		return nil, fmt.Errorf("invalid JSON in the LLM response: %w", err)
+	}
+	return answer.Boundaries, nil
+}
+
+// embeddingBoundaries embeds every sentence and cuts where the similarity between a
+// sentence and the one before drops well below the document's usual similarity: more
+// than split.semantic.threshold standard deviations under the mean.
+func (s *semanticSplitter) embeddingBoundaries(sentences []string) ([]semanticBoundary, error) {
+	model := viper.GetString("split.semantic.embedding_model")
+	pterm.Info.Printf("Embedding %d sentences with %s...\n", len(sentences), model)
+	var vectors [][]float32
+	const batch = 100
+	for i := 0; i < len(sentences); i += batch {
+		input := sentences[i:min(i+batch, len(sentences))]
+		for j, sentence := range input {
+			if sentence == "" {
+				input[j] = " " // the API rejects empty input
+			}
+		}
+		resp, err := s.client.CreateEmbeddings(context.Background(), openai.EmbeddingRequestStrings{
+			Input: input,
+			Model: openai.EmbeddingModel(model),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Data) != len(input) {
+			return nil, fmt.Errorf("expected %d embeddings, got %d", len(input), len(resp.Data))
+		}
+		for _, e := range resp.Data {
+			vectors = append(vectors, e.Embedding)
+		}
+	}
+
+	similarities := make([]float64, len(vectors)-1)
+	for i := 1; i < len(vectors); i++ {
+		similarities[i-1] = cosine(vectors[i-1], vectors[i])
+	}
+	var boundaries []semanticBoundary
+	mean, cutoff := similarityCutoff(similarities, viper.GetFloat64("split.semantic.threshold"))
+	for _, i := range similarityDrops(similarities, cutoff, viper.GetInt("split.semantic.min_sentences")) {
+		boundaries = append(boundaries, semanticBoundary{
+			Before: i + 2,
+			Reason: fmt.Sprintf("similarity to the previous sentence drops to %.2f (document mean %.2f)", similarities[i], mean),
+		})
+	}
+	return boundaries, nil
+}
+
+// similarityCutoff returns the mean of the similarities and the value k standard
+// deviations below it.
+func similarityCutoff(similarities []float64, k float64) (float64, float64) {
+	if len(similarities) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range similarities {
+		sum += v
+	}
+	mean := sum / float64(len(similarities))
+	var variance float64
+	for _, v := range similarities {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, mean - k*math.Sqrt(variance/float64(len(similarities)))
+}
+
+// similarityDrops returns the indexes of the similarities below cutoff that are the
+// lowest of their neighbourhood, keeping at least minSentences sentences per chunk.
+func similarityDrops(similarities []float64, cutoff float64, minSentences int) []int {
+	minSentences = max(minSentences, 1)
+	var drops []int
+	last := -1 // index of the sentence that starts the current chunk, minus one
+	for i, v := range similarities {
+		if v >= cutoff || i-last < minSentences || len(similarities)-i < minSentences {
+			continue
+		}
+		if (i > 0 && similarities[i-1] < v) || (i+1 < len(similarities) && similarities[i+1] < v) {
+			continue // a deeper drop is next door
+		}
+		drops = append(drops, i)
+		last = i
+	}
+	return drops
+}
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		if i >= len(b) {
+			break
+		}
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// cleanBoundaries sorts the boundaries and drops duplicates and out-of-range cuts.
+func cleanBoundaries(boundaries []semanticBoundary, sentences int) []semanticBoundary {
+	sort.SliceStable(boundaries, func(i, j int) bool { return boundaries[i].Before < boundaries[j].Before })
+	var out []semanticBoundary
+	for _, b := range boundaries {
+		if b.Before < 2 || b.Before > sentences || (len(out) > 0 && out[len(out)-1].Before == b.Before) {
+			continue
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// report shows where the text was cut and why: as a table in preview mode, otherwise
+// as a count.
+func (s *semanticSplitter) report(sentences []string, boundaries []semanticBoundary) {
+	if !s.preview {
+		pterm.Info.Printf("Found %d idea boundaries in %d sentences.\n", len(boundaries), len(sentences))
+		return
+	}
+	pterm.DefaultSection.Println("Semantic Boundaries")
+	if len(boundaries) == 0 {
+		pterm.Info.Println("No idea boundaries found; the file stays one note.")
+		return
+	}
+	rows := pterm.TableData{{"Before sentence", "Starts with", "Reason"}}
+	for _, b := range boundaries {
+		rows = append(rows, []string{strconv.Itoa(b.Before), excerpt(sentences[b.Before-1], 50), b.Reason})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(rows).Render()
+}
+
+func excerpt(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+// splitPrompt reads default_split.md from the prompts directory, falling back to the
+// built-in prompt for installs created before semantic splitting existed.
+func splitPrompt() (string, error) {
+	promptFile := filepath.Join(expandPath(viper.GetString("paths.prompts")), "default_split.md")
+	prompt, err := ioutil.ReadFile(promptFile)
+	if os.IsNotExist(err) {
+		prompt, err = zettelflow.DefaultPrompt("default_split.md")
+	}
+	return string(prompt), err
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBoundaries(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     []semanticBoundary
+		wantErr  bool
+	}{
+		{"plain", `{"boundaries": [{"before": 3, "reason": "new topic"}]}`, []semanticBoundary{{3, "new topic"}}, false},
+		{"fenced", "Here you go:\n```json\n{\"boundaries\": [{\"before\": 2}, {\"before\": 5, \"reason\": \"x\"}]}\n```\n", []semanticBoundary{{2, ""}, {5, "x"}}, false},
+		{"none", `{"boundaries": []}`, []semanticBoundary{}, false},
+		{"no JSON", "The text is about one idea.", nil, true},
+		{"invalid JSON", `{"boundaries": [{"before": "three"}]}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBoundaries(tt.response)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBoundaries() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBoundaries() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanBoundaries(t *testing.T) {
+	tests := []struct {
+		name      string
+		before    []int
+		sentences int
+		want      []int
+	}{
+		{"in order", []int{2, 4}, 5, []int{2, 4}},
+		{"out of order", []int{5, 2, 4}, 5, []int{2, 4, 5}},
+		{"duplicates", []int{3, 3, 2, 3}, 5, []int{2, 3}},
+		{"out of range", []int{-1, 0, 1, 6, 9, 3}, 5, []int{3}},
+		{"none left", []int{1, 7}, 5, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var boundaries []semanticBoundary
+			for _, b := range tt.before {
+				boundaries = append(boundaries, semanticBoundary{Before: b})
+			}
+			var got []int
+			for _, b := range cleanBoundaries(boundaries, tt.sentences) {
+				got = append(got, b.Before)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cleanBoundaries(%v, %d) = %v, want %v", tt.before, tt.sentences, got, tt.want)
+			}
+		})
+	}
+
+	// Of duplicates, the first reason given is kept.
+	got := cleanBoundaries([]semanticBoundary{{4, "first"}, {2, ""}, {4, "second"}}, 5)
+	if want := []semanticBoundary{{2, ""}, {4, "first"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cleanBoundaries() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSimilarityDrops(t *testing.T) {
+	tests := []struct {
+		name         string
+		similarities []float64
+		cutoff       float64
+		minSentences int
+		want         []int
+	}{
+		{"one drop", []float64{0.9, 0.2, 0.9, 0.9}, 0.5, 1, []int{1}},
+		{"at the cutoff", []float64{0.9, 0.5, 0.9}, 0.5, 1, nil},
+		{"deeper drop next door", []float64{0.9, 0.3, 0.2, 0.9}, 0.5, 1, []int{2}},
+		{"two drops", []float64{0.1, 0.9, 0.9, 0.2, 0.9}, 0.5, 1, []int{0, 3}},
+		{"too early", []float64{0.9, 0.1, 0.9, 0.9, 0.9}, 0.5, 3, nil},
+		{"too late", []float64{0.9, 0.9, 0.9, 0.1}, 0.5, 2, nil},
+		{"too close to the last cut", []float64{0.9, 0.9, 0.1, 0.9, 0.2, 0.9, 0.9, 0.9}, 0.5, 3, []int{2}},
+		{"far enough from the last cut", []float64{0.9, 0.9, 0.1, 0.9, 0.2, 0.9, 0.9, 0.9}, 0.5, 2, []int{2, 4}},
+		{"no minimum", []float64{0.1, 0.9}, 0.5, 0, []int{0}},
+		{"empty", nil, 0.5, 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := similarityDrops(tt.similarities, tt.cutoff, tt.minSentences); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("similarityDrops() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimilarityThreshold(t *testing.T) {
+	// Mean 0.7, standard deviation about 0.17.
+	similarities := []float64{0.8, 0.8, 0.8, 0.4}
+	tests := []struct {
+		k    float64
+		want []int
+	}{
+		{1, []int{3}},
+		{2, nil},
+	}
+	for _, tt := range tests {
+		mean, cutoff := similarityCutoff(similarities, tt.k)
+		if mean < 0.6999 || mean > 0.7001 {
+			t.Errorf("similarityCutoff() mean = %v, want 0.7", mean)
+		}
+		if got := similarityDrops(similarities, cutoff, 1); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("drops %v standard deviations below the mean = %v, want %v", tt.k, got, tt.want)
+		}
+	}
+}
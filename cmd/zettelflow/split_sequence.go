@@ -0,0 +1,188 @@
+package main
+
+import (
+	"text/template"
+	"time"
+
+	"github.com/pterm/pterm"
+	"gopkg.in/yaml.v3"
+)
+
+// splitRun holds what the notes of all files split in one run share.
+type splitRun struct {
+	tmpl       *template.Template
+	namer      fileNamer
+	splitPath  string
+	enrichPath string
+	ext        string
+	preview    bool
+	structure  bool        // write a structure note per file
+	journal    *runJournal // nil for a preview
+	created    []string    // the notes written so far
+}
+
+// noteSequence turns the chunks of one ingest file into notes as they come. A note is
+// held back until the next one is known, so that it can link to it; the structure note,
+// if any, is written last. Only the names, IDs and titles of earlier notes are kept.
+type noteSequence struct {
+	run           *splitRun
+	source        NoteData // provenance shared by the notes
+	total         int      // number of notes, if known in advance
+	names         *nameReserver
+	ids           *noteIDs
+	tree          noteTree
+	structureFile string
+
+	files   []string
+	titles  []string
+	parents []int
+	held    *NoteData
+}
+
+// newSequence starts the notes of the file with the given ingest header and hash. total
+// is the number of notes the file will give, or 0 if that is not known yet.
+func (r *splitRun) newSequence(header *yaml.Node, sourceHash string, total int) (*noteSequence, error) {
+	ids, err := newNoteIDs(sourceHash, r.preview)
+	if err != nil {
+		return nil, err
+	}
+	s := &noteSequence{
+		run:    r,
+		source: sourceNoteData(header),
+		total:  total,
+		names:  newNameReserver(r.ext, r.namer, r.splitPath, r.enrichPath),
+		ids:    ids,
+	}
+	// The structure note goes straight to the enrich directory, where the notes end up.
+	// Its name is reserved up front, as the notes link to it.
+	if r.structure {
+		s.structureFile, err = s.names.reserve(fileName{
+			Kind:    "structure",
+			Title:   structureTitle(s.source),
+			Content: []byte(sourceHash),
+			Time:    time.Now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// root returns the ID the notes directly under the source have as parent: the source's
+// Folgezettel number, else the structure note's file name, if any.
+func (s *noteSequence) root() string {
+	return firstNonEmpty(s.ids.root, s.structureFile)
+}
+
+// add makes the next note of the sequence from a chunk, and writes the note before it.
+func (s *noteSequence) add(chunk proposedChunk) error {
+	title, tags, body := noteFields(chunk.Text)
+	data := s.source
+	data.Content = body
+	data.Date = time.Now().Format("2006-01-02")
+	data.Title = firstNonEmpty(chunk.Title, title)
+	data.Tags = tags
+	data.Chunk = len(s.files) + 1
+	data.Chunks = s.total
+	data.Location = chunk.Location
+
+	displayTitle := firstNonEmpty(data.Title, deriveTitle(data.Content))
+	file, err := s.names.reserve(fileName{
+		Kind:    "note",
+		Index:   data.Chunk,
+		Title:   displayTitle,
+		Content: []byte(data.Content),
+		Time:    time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	parent := s.tree.add(leadingHeadingLevel(chunk.Text))
+	if data.ID, err = s.ids.next(file, parent); err != nil {
+		return err
+	}
+	data.Parent = s.root()
+	data.ParentLink = wikilink(s.structureFile, s.root())
+	if parent >= 0 {
+		data.Parent = s.ids.ids[parent]
+		data.ParentLink = wikilink(s.files[parent], s.ids.ids[parent])
+	}
+
+	if s.held != nil {
+		prev := len(s.files) - 1
+		data.PrevID = s.held.ID
+		data.PrevLink = wikilink(s.files[prev], s.held.ID)
+		s.held.NextID = data.ID
+		s.held.NextLink = wikilink(file, data.ID)
+		if err := s.write(s.files[prev], *s.held); err != nil {
+			return err
+		}
+	}
+	s.files = append(s.files, file)
+	s.titles = append(s.titles, displayTitle)
+	s.parents = append(s.parents, parent)
+	s.held = &data
+	return nil
+}
+
+// finish writes the last note and the structure note.
+func (s *noteSequence) finish() error {
+	if s.held != nil {
+		if err := s.write(s.files[len(s.files)-1], *s.held); err != nil {
+			return err
+		}
+		s.held = nil
+	}
+	if s.structureFile == "" || len(s.files) == 0 {
+		return nil
+	}
+
+	content, err := renderStructureNote(s.root(), s.source, s.titles, s.files, s.parents)
+	if err != nil {
+		return err
+	}
+	if s.run.preview {
+		pterm.NewStyle(pterm.FgLightCyan, pterm.Bold).Printf("--- Structure Note Preview (%s) ---\n", s.root())
+		pterm.Println(content)
+		return nil
+	}
+	outputFile, err := createReserved(s.run.enrichPath, s.structureFile, s.run.ext, []byte(content))
+	if err != nil {
+		return err
+	}
+	if err := s.run.journal.created(outputFile, []byte(content)); err != nil {
+		return err
+	}
+	pterm.Success.Printf("  - Created structure note: %s\n", outputFile)
+	return nil
+}
+
+// write renders a note and writes it to the split directory under its reserved name.
+func (s *noteSequence) write(file string, data NoteData) error {
+	data.Nav = navLine(data)
+	rendered, err := renderNote(s.run.tmpl, data)
+	if err != nil {
+		return err
+	}
+	rendered, err = ensureProvenance(rendered, data)
+	if err != nil {
+		return err
+	}
+
+	if s.run.preview {
+		pterm.NewStyle(pterm.FgLightCyan, pterm.Bold).Printf("--- Chunk %d Preview (%s) ---\n", data.Chunk, data.ID)
+		pterm.Println(rendered)
+		return nil
+	}
+	outputFile, err := createReserved(s.run.splitPath, file, s.run.ext, []byte(rendered))
+	if err != nil {
+		return err
+	}
+	if err := s.run.journal.created(outputFile, []byte(rendered)); err != nil {
+		return err
+	}
+	pterm.Success.Printf("  - Created note: %s\n", outputFile)
+	s.run.created = append(s.run.created, outputFile)
+	return nil
+}
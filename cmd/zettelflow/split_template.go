@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/user/zettelflow"
+)
+
+// noteFuncs are the helper functions available to note templates.
+var noteFuncs = template.FuncMap{
+	"join": func(sep string, a []string) string {
+		return strings.Join(a, sep)
+	},
+	"yaml":    yamlScalar,
+	"slugify": func(s string) string { return slugify(s, 80) },
+	"lower":   strings.ToLower,
+	// truncate shortens s to at most n bytes at a word boundary: {{ .Title | truncate 40 }}.
+	"truncate": func(n int, s string) string { return truncateWords(s, n) },
+	// now formats the current time with a Go layout: {{ now "2006-01-02T15:04" }}.
+	"now": func(layout string) string { return time.Now().Format(layout) },
+	// default returns fallback when v is empty: {{ .Title | default "Untitled" }}.
+	"default": func(fallback, v interface{}) interface{} {
+		if isEmptyValue(v) {
+			return fallback
+		}
+		return v
+	},
+}
+
+func isEmptyValue(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return true
+	}
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
+
+// templateExtensions are tried in order when a template is named without extension.
+var templateExtensions = []string{"", ".yml", ".yaml", ".md"}
+
+// loadNoteTemplate parses the note template called name: a file path, or the name of a
+// template in the templates directory, with or without extension. Templates shipped with
+// zettelflow are found even if the templates directory predates them.
+func loadNoteTemplate(name string) (*template.Template, error) {
+	if name == "" {
+		name = "note_header"
+	}
+	var content []byte
+	var err error
+	if strings.ContainsRune(name, filepath.Separator) || strings.HasPrefix(name, "~") {
+		content, err = ioutil.ReadFile(expandPath(name))
+	} else {
+		content, err = readNamedTemplate(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(name).Funcs(noteFuncs).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+func readNamedTemplate(name string) ([]byte, error) {
+	dir := expandPath(viper.GetString("paths.templates"))
+	for _, ext := range templateExtensions {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name+ext))
+		if !os.IsNotExist(err) {
+			return content, err
+		}
+	}
+	for _, ext := range templateExtensions {
+		if content, err := zettelflow.DefaultTemplate(name + ext); err == nil {
+			return content, nil
+		}
+	}
+	return nil, fmt.Errorf("no template %q in %s", name, dir)
+}
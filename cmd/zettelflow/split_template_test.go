@@ -0,0 +1,68 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestYAMLFunc(t *testing.T) {
+	tmpl := template.Must(template.New("note").Funcs(noteFuncs).Parse("title: {{ .Title | yaml }}\nnext: x\n"))
+	titles := []string{
+		"Plain words",
+		"Key: value",
+		"- not a list",
+		"# not a comment",
+		"line one\nline two",
+		"'quoted' \"twice\"",
+		"true",
+		"123",
+		"",
+	}
+	for _, title := range titles {
+		var buf strings.Builder
+		if err := tmpl.Execute(&buf, NoteData{Title: title}); err != nil {
+			t.Fatal(err)
+		}
+		var got struct{ Title, Next string }
+		if err := yaml.Unmarshal([]byte(buf.String()), &got); err != nil {
+			t.Errorf("yaml of %q gave invalid YAML %q: %v", title, buf.String(), err)
+			continue
+		}
+		if got.Title != title || got.Next != "x" {
+			t.Errorf("yaml of %q read back as %+v from %q", title, got, buf.String())
+		}
+	}
+}
+
+func TestLoadNoteTemplate(t *testing.T) {
+	dir := testConfig(t)
+	templates := filepath.Join(dir, "templates")
+	writeTestFile(t, filepath.Join(templates, "broken.md"), "title: {{ .Title \n")
+	writeTestFile(t, filepath.Join(templates, "custom.yml"), "title: {{ .Title | yaml }}\n")
+
+	tests := []struct {
+		name    string
+		wantErr string
+	}{
+		{"", ""},
+		{"custom", ""},
+		{filepath.Join(templates, "custom.yml"), ""},
+		{"missing", `no template "missing"`},
+		{"broken", "template broken:"},
+		{filepath.Join(templates, "missing.md"), "no such file"},
+	}
+	for _, tt := range tests {
+		tmpl, err := loadNoteTemplate(tt.name)
+		if tt.wantErr == "" {
+			if err != nil || tmpl == nil {
+				t.Errorf("loadNoteTemplate(%q) = %v", tt.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("loadNoteTemplate(%q) error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
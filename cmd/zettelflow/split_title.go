@@ -0,0 +1,98 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	// #tag, #multi-word_tag or #nested/tag, preceded by the start of a line or a space.
+	// Headings ("# Title") and hex colours or issue numbers (#123) do not match.
+	hashtagPattern = regexp.MustCompile(`(?:^|[\s(])#([\p{L}_][\p{L}\p{N}_/-]*|\p{N}+[\p{L}_][\p{L}\p{N}_/-]*)`)
+	codeFence      = regexp.MustCompile("(?ms)^\\s*(```|~~~).*?^\\s*(```|~~~)[^\\n]*$")
+	codeSpan       = regexp.MustCompile("`[^`\\n]*`")
+)
+
+// noteFields derives the title and tags of a note stub from its chunk, according to
+// split.title (auto, heading, sentence or none), split.hashtags and split.strip_heading.
+// It returns the title, the tags and the note body, which no longer contains a heading
+// consumed as the title.
+func noteFields(chunk string) (string, []string, string) {
+	var tags []string
+	if viper.GetBool("split.hashtags") {
+		tags = hashtags(chunk)
+	}
+
+	mode := viper.GetString("split.title")
+	heading, rest, ok := leadingHeading(chunk)
+	switch {
+	case mode == "none":
+		return "", tags, chunk
+	case ok && (mode == "auto" || mode == "heading"):
+		if viper.GetBool("split.strip_heading") && strings.TrimSpace(rest) != "" {
+			chunk = strings.TrimSpace(rest)
+		}
+		return heading, tags, chunk
+	case mode == "auto" || mode == "sentence":
+		return firstSentence(chunk), tags, chunk
+	}
+	return "", tags, chunk
+}
+
+// leadingHeading returns the text of the heading on the first line of chunk, without
+// Markdown emphasis or closing hashes, and the text after it.
+func leadingHeading(chunk string) (string, string, bool) {
+	line, rest, _ := strings.Cut(chunk, "\n")
+	m := headingPattern.FindStringSubmatch(line)
+	if m == nil {
+		return "", chunk, false
+	}
+	title := strings.TrimSpace(markdownCruft.ReplaceAllString(m[1], ""))
+	if title == "" {
+		return "", chunk, false
+	}
+	return title, rest, true
+}
+
+// leadingHeadingLevel returns the level of the heading on the first line of chunk, or 0.
+func leadingHeadingLevel(chunk string) int {
+	line, _, _ := strings.Cut(chunk, "\n")
+	if _, _, ok := leadingHeading(line); !ok {
+		return 0
+	}
+	line = strings.TrimLeft(line, " ")
+	return len(line) - len(strings.TrimLeft(line, "#"))
+}
+
+// firstSentence returns the first sentence of chunk as plain text, shortened to a
+// title's length. Code and heading markers are skipped, unless the chunk is all code.
+// Both split and the local enrich backend fall back to it for titles.
+func firstSentence(chunk string) string {
+	if prose := codeFence.ReplaceAllString(chunk, ""); strings.TrimSpace(prose) != "" {
+		chunk = prose
+	}
+	chunk = headingMarker.ReplaceAllString(chunk, "")
+	text := strings.Join(strings.Fields(markdownCruft.ReplaceAllString(chunk, "")), " ")
+	if loc := sentenceEnd.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+	return truncateWords(text, 80)
+}
+
+// hashtags collects the inline #tags of a chunk in order of appearance, ignoring code.
+// Tags that differ only in case are kept once, as first written.
+func hashtags(chunk string) []string {
+	text := codeSpan.ReplaceAllString(codeFence.ReplaceAllString(chunk, ""), "")
+	var tags []string
+	seen := map[string]bool{}
+	for _, m := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+		tag := strings.TrimRight(m[1], "/-")
+		if key := strings.ToLower(tag); tag != "" && !seen[key] {
+			seen[key] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFirstSentence(t *testing.T) {
+	tests := []struct {
+		chunk, want string
+	}{
+		{"First idea here. Second idea.", "First idea here"},
+		{"**Bold** start of a _sentence_! More.", "Bold start of a sentence"},
+		{"```\ncode. more\n```\nThe prose part.", "The prose part"},
+		{"```\nonly code\n```", "only code"},
+		{"###\nAfter a bare marker.", "After a bare marker"},
+		{strings.Repeat("word ", 30), "word word word word word word word word word word word word word word word word…"},
+	}
+	for _, tt := range tests {
+		if got := firstSentence(tt.chunk); got != tt.want {
+			t.Errorf("firstSentence(%q) = %q, want %q", tt.chunk, got, tt.want)
+		}
+	}
+}
+
+func TestNoteFields(t *testing.T) {
+	testConfig(t)
+	tests := []struct {
+		name, chunk, title, body string
+		tags                     []string
+	}{
+		{"heading", "## Title One\n\nFirst idea here. #zettel", "Title One", "First idea here. #zettel", []string{"zettel"}},
+		{"sentence", "First idea here. More #a and #b/c.", "First idea here", "First idea here. More #a and #b/c.", []string{"a", "b/c"}},
+		{"code tags ignored", "Text.\n```\n#notatag\n```", "Text", "Text.\n```\n#notatag\n```", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title, tags, body := noteFields(tt.chunk)
+			if title != tt.title || body != tt.body || !reflect.DeepEqual(tags, tt.tags) {
+				t.Errorf("noteFields() = %q, %q, %q, want %q, %q, %q", title, tags, body, tt.title, tt.tags, tt.body)
+			}
+			// The local enrich backend derives the same title from the stripped body.
+			if tt.name == "sentence" && deriveTitle(body) != title {
+				t.Errorf("deriveTitle() = %q, want the split title %q", deriveTitle(body), title)
+			}
+		})
+	}
+}
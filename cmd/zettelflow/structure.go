@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// structureNoteType marks a structure note in its frontmatter (type: structure), so that
+// enrich can find it again.
+const structureNoteType = "structure"
+
+// structureTitle names the structure note of a source: the source's own title, else its
+// file name.
+func structureTitle(source NoteData) string {
+	if source.SourceTitle != "" {
+		return source.SourceTitle
+	}
+	if source.Source != "" && source.Source != "stdin" {
+		return strings.TrimSuffix(filepath.Base(source.Source), filepath.Ext(source.Source))
+	}
+	return "Notes of " + time.Now().Format("2006-01-02")
+}
+
+// renderStructureNote writes the structure note (Map of Content) of a source: a list of
+// links to its notes in reading order, nested like the notes themselves. id is the
+// note's own ID, source carries the provenance shared by the notes, and titles, files
+// and parents describe the notes.
+func renderStructureNote(id string, source NoteData, titles, files []string, parents []int) (string, error) {
+	title := structureTitle(source)
+	fields := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	setFrontmatterField(fields, "id", stringNode(id))
+	setFrontmatterField(fields, "title", stringNode(title))
+	setFrontmatterField(fields, "type", stringNode(structureNoteType))
+	setFrontmatterField(fields, "date", &yaml.Node{Kind: yaml.ScalarNode, Value: time.Now().Format("2006-01-02")})
+	if source.Source != "" {
+		setFrontmatterField(fields, "source", stringNode(source.Source))
+		setFrontmatterField(fields, "source_hash", stringNode(source.SourceHash))
+	}
+	frontmatter, err := marshalFrontmatter(fields)
+	if err != nil {
+		return "", err
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "# %s\n\n", title)
+	depths := make([]int, len(files))
+	for i, file := range files {
+		if p := parents[i]; p >= 0 {
+			depths[i] = depths[p] + 1
+		}
+		fmt.Fprintf(&body, "%s- [[%s|%s]]\n", strings.Repeat("  ", depths[i]), file, linkTitle(titles[i]))
+	}
+	return fmt.Sprintf("---\n%s\n---\n%s", frontmatter, body.String()), nil
+}
+
+// linkTitle makes s safe to use as the alias of a wikilink.
+func linkTitle(s string) string {
+	return strings.NewReplacer("|", "-", "[", "(", "]", ")", "\n", " ").Replace(s)
+}
+
+// structureEntry matches a list entry of a structure note: indentation and bullet, the
+// linked file and its title.
+var structureEntry = regexp.MustCompile(`(?m)^(\s*- )\[\[([^\]|]+)(?:\|[^\]]*)?\]\]$`)
+
+// refreshStructureNotes updates the titles listed in the structure notes of dir after
+// enrich has retitled notes. titles maps the file names of the enriched notes, without
+// extension, to their new titles.
+func refreshStructureNotes(dir string, titles map[string]string) error {
+	if len(titles) == 0 {
+		return nil
+	}
+	ext := viper.GetString("split.output_extension")
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ext {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		frontmatter, body := splitFrontmatter(string(content))
+		if !strings.Contains(frontmatter, structureNoteType) {
+			continue
+		}
+		if fields, err := parseFrontmatter(frontmatter); err != nil || headerValue(fields, "type") != structureNoteType {
+			continue
+		}
+		updated := structureEntry.ReplaceAllStringFunc(body, func(entry string) string {
+			m := structureEntry.FindStringSubmatch(entry)
+			if title, ok := titles[m[2]]; ok && title != "" {
+				return fmt.Sprintf("%s[[%s|%s]]", m[1], m[2], linkTitle(title))
+			}
+			return entry
+		})
+		if updated == body {
+			continue
+		}
+		refreshed := []byte(strings.TrimSuffix(string(content), body) + updated)
+		if err := writeFileAtomic(path, refreshed); err != nil {
+			return err
+		}
+		if err := rewritten(path, content, refreshed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
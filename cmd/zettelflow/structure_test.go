@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderStructureNote(t *testing.T) {
+	source := NoteData{Source: "/books/notes.txt", SourceHash: "sha256:abc"}
+	titles := []string{"Intro", "Detail", "Finer | point", "Outro"}
+	files := []string{"n1", "n2", "n3", "n4"}
+	note, err := renderStructureNote("42", source, titles, files, []int{-1, 0, 1, -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frontmatter, body := splitFrontmatter(note)
+	fields, err := parseFrontmatter(frontmatter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"id": "42", "title": "notes", "type": structureNoteType, "source_hash": "sha256:abc"} {
+		if got := headerValue(fields, key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	want := "# notes\n\n" +
+		"- [[n1|Intro]]\n" +
+		"  - [[n2|Detail]]\n" +
+		"    - [[n3|Finer - point]]\n" +
+		"- [[n4|Outro]]\n"
+	if strings.TrimLeft(body, "\n") != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestLinkTitle(t *testing.T) {
+	tests := []struct{ s, want string }{
+		{"Plain title", "Plain title"},
+		{"A | B", "A - B"},
+		{"See [[other]]", "See ((other))"},
+		{"Two\nlines", "Two lines"},
+	}
+	for _, tt := range tests {
+		if got := linkTitle(tt.s); got != tt.want {
+			t.Errorf("linkTitle(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestRefreshStructureNotes(t *testing.T) {
+	testConfig(t)
+	dir := t.TempDir()
+	structure := "---\ntype: structure\n---\n# Book\n\n- [[n1|Old]]\n  - [[n2|Kept]]\n"
+	list := "---\ntype: note\ntags: [structure]\n---\n- [[n1|Old]]\n"
+	plain := "- [[n1|Old]]\n"
+	files := map[string]string{"structure.md": structure, "list.md": list, "plain.md": plain, "other.txt": structure}
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(dir, name), content)
+	}
+	j, err := newJournal("split")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.created(filepath.Join(dir, "structure.md"), []byte(structure)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := refreshStructureNotes(dir, map[string]string{"n1": "New [title]"}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"structure.md": "---\ntype: structure\n---\n# Book\n\n- [[n1|New (title)]]\n  - [[n2|Kept]]\n",
+		"list.md":      list,
+		"plain.md":     plain,
+		"other.txt":    structure,
+	}
+	for name, content := range want {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("%s = %q, want %q", name, data, content)
+		}
+	}
+
+	// The rewrite is recorded, so undo does not take it for an edit.
+	journals, err := loadJournals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(journals) != 1 {
+		t.Fatalf("found %d journals, want 1", len(journals))
+	}
+	if problems := journals[0].undoProblems(); len(problems) > 0 {
+		t.Errorf("undoProblems() = %q, want none", problems)
+	}
+}
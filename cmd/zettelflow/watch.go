@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [inbox...]",
+	Short: "Watch inbox directories and ingest files dropped into them.",
+	Long: `Monitors the inbox directories (watch.inboxes, or the directories given as arguments) and
+ingests every file that appears in them, optionally running split and enrich afterwards.
+Handled files are moved to a processed subdirectory of their inbox. Files already in an
+inbox when watch starts are handled first, and the ingest manifest keeps a restart from
+sending anything to the LLM twice.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		inboxes := args
+		if len(inboxes) == 0 {
+			inboxes = viper.GetStringSlice("watch.inboxes")
+		}
+		if len(inboxes) == 0 {
+			pterm.Error.Println("Error: no inbox directories given and watch.inboxes is empty.")
+			os.Exit(1)
+		}
+		for i, inbox := range inboxes {
+			inboxes[i] = expandPath(inbox)
+			cobra.CheckErr(os.MkdirAll(filepath.Join(inboxes[i], "processed"), 0755))
+		}
+
+		w := inboxWatcher{cmd: cmd, debounce: viper.GetDuration("watch.debounce")}
+		if cmd.Flags().Changed("debounce") {
+			w.debounce, _ = cmd.Flags().GetDuration("debounce")
+		}
+		w.split = viper.GetBool("watch.split")
+		if cmd.Flags().Changed("split") {
+			w.split, _ = cmd.Flags().GetBool("split")
+		}
+		w.enrich = viper.GetBool("watch.enrich")
+		if cmd.Flags().Changed("enrich") {
+			w.enrich, _ = cmd.Flags().GetBool("enrich")
+		}
+		w.backend = viper.GetString("enrich.backend")
+
+		if raw, _ := cmd.Flags().GetBool("raw"); !raw {
+			checkAPIKey()
+		}
+		pterm.DefaultBox.WithTitle("Watch").Println("Watching for new sources...")
+		pterm.DefaultSection.Println("Using Watch Settings")
+		leveledList := pterm.LeveledList{
+			{Level: 0, Text: fmt.Sprintf("Inboxes: %s", strings.Join(inboxes, ", "))},
+			{Level: 0, Text: fmt.Sprintf("Debounce: %s", w.debounce)},
+			{Level: 0, Text: fmt.Sprintf("Split: %t", w.split || w.enrich)},
+			{Level: 0, Text: fmt.Sprintf("Enrich: %t", w.enrich)},
+		}
+		pterm.DefaultTree.WithRoot(pterm.NewTreeFromLeveledList(leveledList)).Render()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		cobra.CheckErr(w.run(ctx, inboxes))
+		pterm.Info.Println("Watch stopped.")
+	},
+}
+
+// inboxWatcher turns file system events in the inboxes into pipeline runs. Events are
+// debounced per file so that a file is only handled once its writer has finished.
+type inboxWatcher struct {
+	cmd      *cobra.Command
+	debounce time.Duration
+	split    bool
+	enrich   bool
+	backend  string
+
+	mu      sync.Mutex
+	pending map[string]*time.Timer
+	ready   chan string
+	stop    chan struct{}
+}
+
+// run watches the inboxes until ctx is cancelled. Files are handled one at a time.
+func (w *inboxWatcher) run(ctx context.Context, inboxes []string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	for _, inbox := range inboxes {
+		if err := watcher.Add(inbox); err != nil {
+			return fmt.Errorf("watching %s: %w", inbox, err)
+		}
+	}
+
+	w.pending = map[string]*time.Timer{}
+	w.ready = make(chan string)
+	w.stop = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case path := <-w.ready:
+				w.handle(path)
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+	defer func() {
+		w.mu.Lock()
+		for _, t := range w.pending {
+			t.Stop()
+		}
+		w.pending = nil
+		w.mu.Unlock()
+		close(w.stop)
+		<-done
+	}()
+
+	// Files dropped while watch was not running.
+	for _, inbox := range inboxes {
+		entries, err := os.ReadDir(inbox)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				w.schedule(filepath.Join(inbox, e.Name()))
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) || event.Has(fsnotify.Chmod) {
+				w.schedule(event.Name)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			pterm.Warning.Printf("Watch error: %v\n", err)
+		}
+	}
+}
+
+// schedule (re)starts the debounce timer of path. When no further event arrives for the
+// debounce interval, the file is passed on to be handled.
+func (w *inboxWatcher) schedule(path string) {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pending == nil {
+		return
+	}
+	if t, ok := w.pending[path]; ok {
+		t.Reset(w.debounce)
+		return
+	}
+	w.pending[path] = time.AfterFunc(w.debounce, func() {
+		w.mu.Lock()
+		if w.pending == nil {
+			w.mu.Unlock()
+			return
+		}
+		delete(w.pending, path)
+		w.mu.Unlock()
+		select {
+		case w.ready <- path:
+		case <-w.stop:
+		}
+	})
+}
+
+// handle ingests one inbox file and moves it to the processed subdirectory. Failures
+// are reported and leave the file in the inbox, to be retried on the next start.
+func (w *inboxWatcher) handle(path string) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return // moved away, or a directory
+	}
+	filter, err := newSourceFilter(w.cmd)
+	if err != nil {
+		pterm.Error.Printf("Skipping %s: %v\n", path, err)
+		return
+	}
+	if reason := filter.check(path, info); reason != "" {
+		pterm.Warning.Printf("Skipping %s: %s\n", path, reason)
+		return
+	}
+
+	manifest, err := loadManifest()
+	if err != nil {
+		pterm.Error.Printf("Failed to read manifest: %v\n", err)
+		return
+	}
+	pterm.Info.Printf("Ingesting file: %s\n", path)
+	reason, err := ingestFile(path, manifest, w.cmd)
+	if err != nil {
+		pterm.Error.Printf("Failed to ingest %s: %v\n", path, err)
+		return
+	}
+	if reason != "" {
+		pterm.Info.Printf("Not ingesting %s again: %s\n", path, reason)
+	}
+	dest, err := moveExclusive(path, filepath.Join(filepath.Dir(path), "processed"))
+	if err != nil {
+		pterm.Error.Printf("Failed to move %s to processed: %v\n", path, err)
+		return
+	}
+	pterm.Debug.Printf("  - Moved source to: %s\n", dest)
+
+	if reason != "" || !(w.split || w.enrich) {
+		return
+	}
+	notes, err := splitPending(splitCmd)
+	if err != nil {
+		pterm.Error.Printf("Failed to split: %v\n", err)
+		return
+	}
+	if w.enrich && len(notes) > 0 {
+		if err := enrichPending(w.backend, notes); err != nil {
+			pterm.Error.Printf("Failed to enrich: %v\n", err)
+		}
+	}
+}
+
+// moveExclusive moves path into dir without replacing a file of the same name there,
+// adding a -2, -3, … suffix instead.
+func moveExclusive(path, dir string) (string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(filepath.Base(path), ext)
+	for attempt := 1; attempt <= maxNameAttempts; attempt++ {
+		name := base + ext
+		if attempt > 1 {
+			name = fmt.Sprintf("%s-%d%s", base, attempt, ext)
+		}
+		dest := filepath.Join(dir, name)
+		err := os.Link(path, dest)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			// No hard links: check and rename, which is good enough for a single watcher.
+			if _, statErr := os.Stat(dest); statErr == nil {
+				continue
+			}
+			return dest, os.Rename(path, dest)
+		}
+		return dest, os.Remove(path)
+	}
+	return "", fmt.Errorf("no free file name in %s after %d attempts", dir, maxNameAttempts)
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().StringP("prompt", "p", "", "Path to a custom prompt file")
+	watchCmd.Flags().String("format", "auto", "Source format: "+strings.Join(extractorNames(), ", "))
+	watchCmd.Flags().Bool("raw", false, "Save sources as they are, without an LLM pass")
+	watchCmd.Flags().Duration("debounce", 0, "Wait this long after the last write before handling a file (default watch.debounce)")
+	watchCmd.Flags().Bool("split", false, "Run split after each ingest (default watch.split)")
+	watchCmd.Flags().Bool("enrich", false, "Run split and enrich after each ingest (default watch.enrich)")
+}
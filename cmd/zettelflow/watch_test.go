@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveExclusive(t *testing.T) {
+	inbox := t.TempDir()
+	processed := filepath.Join(inbox, "processed")
+	writeTestFile(t, filepath.Join(processed, "notes.txt"), "processed earlier")
+	writeTestFile(t, filepath.Join(processed, "notes-2.txt"), "processed second")
+
+	tests := []struct {
+		content, want string
+	}{
+		{"third", "notes-3.txt"},
+		{"fourth", "notes-4.txt"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(inbox, "notes.txt")
+		writeTestFile(t, path, tt.content)
+		dest, err := moveExclusive(path, processed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Base(dest) != tt.want {
+			t.Errorf("moveExclusive() = %s, want %s", dest, tt.want)
+		}
+		if data, err := os.ReadFile(dest); err != nil || string(data) != tt.content {
+			t.Errorf("%s holds %q, %v, want %q", dest, data, err, tt.content)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("moveExclusive() left %s in place: %v", path, err)
+		}
+	}
+
+	for name, want := range map[string]string{"notes.txt": "processed earlier", "notes-2.txt": "processed second"} {
+		if data, _ := os.ReadFile(filepath.Join(processed, name)); string(data) != want {
+			t.Errorf("moveExclusive() overwrote %s with %q", name, data)
+		}
+	}
+}
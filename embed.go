@@ -44,9 +44,11 @@ func FirstRunInit() {
 		// --- Write default prompts ---
 		writeFileFromEmbed("assets/prompts/default_ingest.md", filepath.Join(promptsDir, "default_ingest.md"))
 		writeFileFromEmbed("assets/prompts/default_enrich.md", filepath.Join(promptsDir, "default_enrich.md"))
+		writeFileFromEmbed("assets/prompts/default_split.md", filepath.Join(promptsDir, "default_split.md"))
 
-		// --- Write default template ---
+		// --- Write default templates ---
 		writeFileFromEmbed("assets/yaml_templates/note_header.yml", filepath.Join(templateDir, "note_header.yml"))
+		writeFileFromEmbed("assets/yaml_templates/linked.yml", filepath.Join(templateDir, "linked.yml"))
 
 		// --- Create data directories ---
 		fmt.Println("Reading configuration to create data directories...")
@@ -77,6 +79,18 @@ func FirstRunInit() {
 	}
 }
 
+// DefaultPrompt returns a prompt shipped with zettelflow, for installs whose prompts
+// directory predates it.
+func DefaultPrompt(name string) ([]byte, error) {
+	return assets.ReadFile("assets/prompts/" + name)
+}
+
+// DefaultTemplate returns a note template shipped with zettelflow, for installs whose
+// templates directory predates it.
+func DefaultTemplate(name string) ([]byte, error) {
+	return assets.ReadFile("assets/yaml_templates/" + name)
+}
+
 // writeFileFromEmbed reads a file from the embedded assets and writes it to the destination path.
 func writeFileFromEmbed(sourcePath, destPath string) {
 	content, err := assets.ReadFile(sourcePath)
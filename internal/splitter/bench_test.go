@@ -0,0 +1,82 @@
+package splitter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// benchText returns a Markdown text of about words words: sections with a heading, a few
+// paragraphs, a list and now and then a code block, separated by "###".
+func benchText(words int) string {
+	var b strings.Builder
+	sentence := "The quick brown fox jumps over the lazy dog near the river bank. "
+	perSentence := len(strings.Fields(sentence))
+	for section, n := 1, 0; n < words; section++ {
+		fmt.Fprintf(&b, "## Section %d\n\n", section)
+		for p := 0; p < 3; p++ {
+			b.WriteString(strings.Repeat(sentence, 4) + "\n\n")
+			n += 4 * perSentence
+		}
+		b.WriteString("- first point\n- second point ###\n\n")
+		if section%5 == 0 {
+			b.WriteString("```go\nfmt.Println(\"###\")\n```\n\n")
+		}
+		b.WriteString("###\n\n")
+	}
+	return b.String()
+}
+
+// The performance budget of the technical specification is to split 10k words in under
+// 150 ms.
+const benchWords = 10000
+
+func benchmarkSplit(b *testing.B, split Func) {
+	text := benchText(benchWords)
+	b.SetBytes(int64(len(text)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		split(text)
+	}
+}
+
+func BenchmarkDelimiter(b *testing.B) {
+	benchmarkSplit(b, func(text string) []string { return Delimiter(text, "###") })
+}
+
+func BenchmarkDelimiterStream(b *testing.B) {
+	benchmarkSplit(b, func(text string) []string {
+		var chunks []string
+		DelimiterStream(strings.NewReader(text), "###", func(chunk string) error {
+			chunks = append(chunks, chunk)
+			return nil
+		})
+		return chunks
+	})
+}
+
+func BenchmarkHeadings(b *testing.B) {
+	benchmarkSplit(b, func(text string) []string { return Headings(text, 2) })
+}
+
+func BenchmarkParagraphs(b *testing.B) {
+	benchmarkSplit(b, Paragraphs)
+}
+
+func BenchmarkSentences(b *testing.B) {
+	benchmarkSplit(b, func(text string) []string { return Sentences(text, 5) })
+}
+
+func BenchmarkTokens(b *testing.B) {
+	benchmarkSplit(b, func(text string) []string { return Tokens(text, 300, 30) })
+}
+
+func BenchmarkClean(b *testing.B) {
+	benchmarkSplit(b, func(text string) []string {
+		var chunks []string
+		for _, chunk := range Delimiter(text, "###") {
+			chunks = append(chunks, Clean(chunk))
+		}
+		return chunks
+	})
+}
@@ -0,0 +1,218 @@
+package splitter
+
+import (
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// markdown parses CommonMark with GitHub tables, whose rows must not be split either.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.Table))
+
+// span is the byte range of a Markdown block, from the start of its first line to the
+// end of its last non-blank line.
+type span struct {
+	start, end int
+	node       ast.Node
+}
+
+// contains reports whether offset lies inside the block.
+func (s span) contains(offset int) bool {
+	return offset >= s.start && offset < s.end
+}
+
+// comment reports whether the block is an HTML comment, such as a location marker.
+func (s span) comment() bool {
+	html, ok := s.node.(*ast.HTMLBlock)
+	return ok && html.HTMLBlockType == ast.HTMLBlockType2
+}
+
+// document is the block structure of a Markdown text.
+type document struct {
+	blocks    []span // top-level blocks
+	protected []span // code blocks, HTML blocks, tables and lists, which are never cut
+}
+
+func parse(src string) document {
+	root := markdown.Parser().Parse(text.NewReader([]byte(src)))
+	var doc document
+	var walk func(parent ast.Node, end int, top bool)
+	walk = func(parent ast.Node, end int, top bool) {
+		for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+			start := blockStart(n)
+			if start < 0 {
+				continue
+			}
+			stop := end
+			for next := n.NextSibling(); next != nil; next = next.NextSibling() {
+				if s := blockStart(next); s >= 0 {
+					stop = s
+					break
+				}
+			}
+			start = lineStart(src, start)
+			stop = max(start, lineStart(src, stop))
+			s := span{start: start, end: start + len(strings.TrimRight(src[start:stop], " \t\r\n")), node: n}
+			if top {
+				doc.blocks = append(doc.blocks, s)
+			}
+			switch n.Kind() {
+			case ast.KindFencedCodeBlock, ast.KindCodeBlock, ast.KindHTMLBlock, ast.KindList, east.KindTable:
+				doc.protected = append(doc.protected, s)
+			case ast.KindBlockquote:
+				walk(n, stop, false)
+			}
+		}
+	}
+	walk(root, len(src), true)
+	return doc
+}
+
+// blockStart returns the offset at which a block node starts, or -1 if it has none.
+func blockStart(n ast.Node) int {
+	if n.Type() != ast.TypeBlock {
+		return -1
+	}
+	if pos := n.Pos(); pos >= 0 {
+		return pos
+	}
+	if lines := n.Lines(); lines != nil && lines.Len() > 0 {
+		return lines.At(0).Start
+	}
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if pos := blockStart(c); pos >= 0 {
+			return pos
+		}
+	}
+	return -1
+}
+
+func lineStart(src string, offset int) int {
+	offset = min(offset, len(src))
+	return strings.LastIndexByte(src[:offset], '\n') + 1
+}
+
+// protectedAt returns the protected block containing offset, if any.
+func (d document) protectedAt(offset int) (span, bool) {
+	for _, s := range d.protected {
+		if s.contains(offset) {
+			return s, true
+		}
+	}
+	return span{}, false
+}
+
+// cutAt splits text at the given separator ranges, which are removed. Separators that
+// overlap a protected block are ignored.
+func cutAt(text string, separators [][]int) []string {
+	if len(separators) == 0 {
+		return []string{text}
+	}
+	doc := parse(text)
+	var chunks []string
+	start := 0
+	for _, sep := range separators {
+		if sep[1] == 0 || sep[0] < start || doc.overlaps(sep[0], sep[1]) {
+			continue
+		}
+		chunks = append(chunks, text[start:sep[0]])
+		start = sep[1]
+	}
+	return append(chunks, text[start:])
+}
+
+func (d document) overlaps(start, end int) bool {
+	for _, s := range d.protected {
+		if start < s.end && max(end, start+1) > s.start {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachLine calls fn for every line of the parsed text with its byte offset and the
+// protected block it belongs to, if any.
+func (doc document) forEachLine(text string, fn func(offset int, line string, block *span)) {
+	for offset := 0; offset < len(text); {
+		end := strings.IndexByte(text[offset:], '\n')
+		if end == -1 {
+			end = len(text)
+		} else {
+			end += offset + 1
+		}
+		var block *span
+		if s, ok := doc.protectedAt(offset); ok {
+			block = &s
+		}
+		fn(offset, text[offset:end], block)
+		offset = end
+	}
+}
+
+// Clean tidies the Markdown of a chunk: it removes empty headings, such as a delimiter
+// left over from another strategy, and thematic breaks at the start or end of the
+// chunk, trims trailing whitespace and collapses runs of blank lines. Code blocks, HTML
+// blocks, tables and lists are left as they are.
+func Clean(chunk string) string {
+	doc := parse(chunk)
+	var drop []span
+	for _, b := range doc.blocks {
+		if h, ok := b.node.(*ast.Heading); ok && h.FirstChild() == nil {
+			drop = append(drop, b)
+		}
+	}
+	kept := func() []span {
+		var out []span
+		for _, b := range doc.blocks {
+			if !containsSpan(drop, b) {
+				out = append(out, b)
+			}
+		}
+		return out
+	}
+	for blocks := kept(); len(blocks) > 0 && blocks[0].node.Kind() == ast.KindThematicBreak; blocks = kept() {
+		drop = append(drop, blocks[0])
+	}
+	for blocks := kept(); len(blocks) > 0 && blocks[len(blocks)-1].node.Kind() == ast.KindThematicBreak; blocks = kept() {
+		drop = append(drop, blocks[len(blocks)-1])
+	}
+
+	var out strings.Builder
+	blank := 0
+	doc.forEachLine(chunk, func(offset int, line string, block *span) {
+		for _, d := range drop {
+			if d.contains(offset) {
+				return
+			}
+		}
+		if block != nil {
+			blank = 0
+			out.WriteString(line)
+			return
+		}
+		line = strings.TrimRight(line, " \t\r\n")
+		if line == "" {
+			blank++
+			if blank > 1 {
+				return
+			}
+		} else {
+			blank = 0
+		}
+		out.WriteString(line + "\n")
+	})
+	return strings.TrimSpace(out.String())
+}
+
+func containsSpan(spans []span, s span) bool {
+	for _, t := range spans {
+		if t.start == s.start {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package splitter
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+const structured = `Intro
+###
+` + "```" + `
+code ###
+` + "```" + `
+
+| a | ### |
+|---|-----|
+| 1 | 2   |
+
+- one ###
+- two
+
+  still two ###
+
+<div>
+###
+</div>
+
+###
+Outro`
+
+func TestDelimiterSkipsBlocks(t *testing.T) {
+	got := trimmed(Delimiter(structured, "###"))
+	want := []string{
+		"Intro",
+		"```\ncode ###\n```\n\n| a | ### |\n|---|-----|\n| 1 | 2   |\n\n- one ###\n- two\n\n  still two ###\n\n<div>\n###\n</div>",
+		"Outro",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Delimiter() = %q, want %q", got, want)
+	}
+}
+
+func TestRegexSkipsBlocks(t *testing.T) {
+	got := trimmed(Regex("a\n---\n```\n---\n```\n---\nb", regexp.MustCompile(`(?m)^---$`)))
+	want := []string{"a", "```\n---\n```", "b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Regex() = %q, want %q", got, want)
+	}
+}
+
+func TestHeadingsSkipsNested(t *testing.T) {
+	text := "Setext\n======\nA\n- item\n  ## not split\n> ## quoted\n\nSub\n---\nB"
+	got := trimmed(Headings(text, 2))
+	want := []string{"Setext\n======\nA\n- item\n  ## not split\n> ## quoted", "Sub\n---\nB"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Headings() = %q, want %q", got, want)
+	}
+}
+
+func TestParagraphsKeepsLists(t *testing.T) {
+	text := "Intro\n\n- a\n\n- b\n\n<div>\n\n</div>\n\nEnd"
+	got := trimmed(Paragraphs(text))
+	want := []string{"Intro", "- a\n\n- b", "<div>", "</div>", "End"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Paragraphs() = %q, want %q", got, want)
+	}
+}
+
+func TestSentencesTable(t *testing.T) {
+	text := "Before. <!-- zettelflow:location page 2 -->\nNext one.\n\n| a. | B. |\n|---|---|\n\nAfter."
+	got := trimmed(Sentences(text, 1))
+	want := []string{"Before.", "<!-- zettelflow:location page 2 -->\nNext one.", "| a. | B. |\n|---|---|", "After."}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Sentences() = %q, want %q", got, want)
+	}
+}
+
+func TestTokensKeepsBlocksWhole(t *testing.T) {
+	text := "a b\n\n```\nx y z\n```\n\nc d"
+	got := Tokens(text, 3, 1)
+	want := []string{"a b", "```\nx y z\n```", "c d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokens() = %q, want %q", got, want)
+	}
+}
+
+func TestClean(t *testing.T) {
+	text := "---\n\n## \nText   \n\n\n\nMore\n\n```\nkeep  \n\n\n```\n###\n\n* * *\n"
+	want := "Text\n\nMore\n\n```\nkeep  \n\n\n```"
+	if got := Clean(text); got != want {
+		t.Errorf("Clean() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,317 @@
+// Package splitter cuts the text of an ingest output into the chunks that become notes.
+// Every strategy is a pure function from text to chunks. Chunks keep the original text,
+// including whitespace; callers trim them and drop empty ones.
+package splitter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// Func splits text into chunks.
+type Func func(text string) []string
+
+// Options holds the parameters of the strategies. A strategy reads only its own fields.
+type Options struct {
+	Delimiter    string // delimiter: the literal separator
+	HeadingLevel int    // heading: split before headings of this level or higher
+	Sentences    int    // sentence: sentences per chunk
+	MaxTokens    int    // tokens: window size
+	Overlap      int    // tokens: tokens shared by consecutive windows
+	Pattern      string // regex: the separator pattern
+}
+
+// Names lists the available strategies.
+func Names() []string {
+	return []string{"delimiter", "heading", "paragraph", "sentence", "tokens", "regex"}
+}
+
+// New returns the strategy named by spec. A spec is a strategy name, optionally followed
+// by a colon and the strategy's main parameter, which overrides the one in opts:
+// "delimiter:---", "heading:2", "sentence:5", "tokens:300" or "regex:^\* \* \*$".
+func New(spec string, opts Options) (Func, error) {
+	name, arg, hasArg := strings.Cut(strings.TrimSpace(spec), ":")
+	number := func(field string, current int) (int, error) {
+		if !hasArg {
+			return current, nil
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return 0, fmt.Errorf("%s strategy: invalid %s %q", name, field, arg)
+		}
+		return n, nil
+	}
+
+	var err error
+	switch name {
+	case "", "delimiter":
+		if hasArg {
+			opts.Delimiter = arg
+		}
+		if opts.Delimiter == "" {
+			return nil, fmt.Errorf("delimiter strategy: empty delimiter")
+		}
+		return func(text string) []string { return Delimiter(text, opts.Delimiter) }, nil
+	case "heading":
+		if opts.HeadingLevel, err = number("heading level", opts.HeadingLevel); err != nil {
+			return nil, err
+		}
+		if opts.HeadingLevel < 1 || opts.HeadingLevel > 6 {
+			return nil, fmt.Errorf("heading strategy: level must be between 1 and 6, got %d", opts.HeadingLevel)
+		}
+		return func(text string) []string { return Headings(text, opts.HeadingLevel) }, nil
+	case "paragraph":
+		return Paragraphs, nil
+	case "sentence":
+		if opts.Sentences, err = number("sentence count", opts.Sentences); err != nil {
+			return nil, err
+		}
+		if opts.Sentences < 1 {
+			return nil, fmt.Errorf("sentence strategy: sentence count must be at least 1, got %d", opts.Sentences)
+		}
+		return func(text string) []string { return Sentences(text, opts.Sentences) }, nil
+	case "tokens":
+		if opts.MaxTokens, err = number("token count", opts.MaxTokens); err != nil {
+			return nil, err
+		}
+		if opts.MaxTokens < 1 {
+			return nil, fmt.Errorf("tokens strategy: window must be at least 1 token, got %d", opts.MaxTokens)
+		}
+		if opts.Overlap < 0 || opts.Overlap >= opts.MaxTokens {
+			return nil, fmt.Errorf("tokens strategy: overlap must be between 0 and %d, got %d", opts.MaxTokens-1, opts.Overlap)
+		}
+		return func(text string) []string { return Tokens(text, opts.MaxTokens, opts.Overlap) }, nil
+	case "regex":
+		if hasArg {
+			opts.Pattern = arg
+		}
+		if opts.Pattern == "" {
+			return nil, fmt.Errorf("regex strategy: empty pattern")
+		}
+		re, err := regexp.Compile("(?m)" + opts.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("regex strategy: %w", err)
+		}
+		return func(text string) []string { return Regex(text, re) }, nil
+	}
+	return nil, fmt.Errorf("unknown split strategy %q (expected one of: %s)", name, strings.Join(Names(), ", "))
+}
+
+// Delimiter splits text at every occurrence of delimiter, which is removed. Occurrences
+// inside code blocks, HTML blocks, tables and lists are not separators.
+func Delimiter(text, delimiter string) []string {
+	var separators [][]int
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], delimiter)
+		if i == -1 {
+			break
+		}
+		offset += i + len(delimiter)
+		separators = append(separators, []int{offset - len(delimiter), offset})
+	}
+	return cutAt(text, separators)
+}
+
+// Regex splits text at every match of re, which is removed. Matches inside code blocks,
+// HTML blocks, tables and lists are not separators.
+func Regex(text string, re *regexp.Regexp) []string {
+	return cutAt(text, re.FindAllStringIndex(text, -1))
+}
+
+// Headings starts a new chunk at every top-level heading of the given level or higher
+// (# … for level 1, # or ## for level 2, …; setext headings count as levels 1 and 2).
+// Text before the first heading is a chunk of its own. Lines inside code blocks, lists
+// or block quotes are never headings.
+func Headings(text string, level int) []string {
+	var chunks []string
+	start := 0
+	for _, b := range parse(text).blocks {
+		if h, ok := b.node.(*ast.Heading); ok && h.Level <= level && b.start > 0 {
+			chunks = append(chunks, text[start:b.start])
+			start = b.start
+		}
+	}
+	return append(chunks, text[start:])
+}
+
+// Paragraphs splits text at blank lines outside code blocks, HTML blocks, tables and
+// lists, so that such a block stays in one chunk.
+func Paragraphs(text string) []string {
+	var chunks []string
+	start := 0
+	parse(text).forEachLine(text, func(offset int, line string, block *span) {
+		if block != nil || strings.TrimSpace(line) != "" {
+			return
+		}
+		chunks = append(chunks, text[start:offset])
+		start = offset + len(line)
+	})
+	return append(chunks, text[start:])
+}
+
+// Sentences groups every n sentences into a chunk. A sentence ends at ., ! or ? followed
+// by whitespace and the start of a new sentence, or at a blank line. A code block, HTML
+// block, table or list counts as one sentence. Common abbreviations do not end
+// sentences.
+func Sentences(text string, n int) []string {
+	var chunks []string
+	start, count := 0, 0
+	for _, end := range sentenceEnds(text) {
+		count++
+		if count == n {
+			chunks = append(chunks, text[start:end])
+			start, count = end, 0
+		}
+	}
+	if start < len(text) {
+		chunks = append(chunks, text[start:])
+	}
+	return chunks
+}
+
+// Tokens cuts text into windows of at most max tokens, each starting overlap tokens
+// before the end of the previous one. Tokens are approximated by whitespace-separated
+// words; HTML comments count as one token. Code blocks, HTML blocks, tables and lists
+// are never cut: such a block goes into a window as a whole, even if it alone is longer
+// than max tokens.
+func Tokens(text string, max, overlap int) []string {
+	atoms := tokenAtoms(text)
+	if len(atoms) == 0 {
+		return []string{text}
+	}
+	var chunks []string
+	for i := 0; i < len(atoms); {
+		j, n := i, 0
+		for j < len(atoms) && (j == i || n+atoms[j].tokens <= max) {
+			n += atoms[j].tokens
+			j++
+		}
+		chunks = append(chunks, text[atoms[i].start:atoms[j-1].end])
+		if j == len(atoms) {
+			break
+		}
+		// Step back over the tokens the next window shares, as long as it still moves
+		// forward and has room for the atom that did not fit.
+		k, shared := j, 0
+		for k-1 > i && shared+atoms[k-1].tokens <= overlap && shared+atoms[k-1].tokens+atoms[j].tokens <= max {
+			k--
+			shared += atoms[k].tokens
+		}
+		i = k
+	}
+	return chunks
+}
+
+var tokenPattern = regexp.MustCompile(`<!--[\s\S]*?-->|\S+`)
+
+// atom is a word, or a block that is never cut, with the number of tokens it holds.
+type atom struct {
+	start, end, tokens int
+}
+
+func tokenAtoms(text string) []atom {
+	doc := parse(text)
+	var atoms []atom
+	for _, w := range tokenPattern.FindAllStringIndex(text, -1) {
+		block, ok := doc.protectedAt(w[0])
+		switch {
+		case !ok:
+			atoms = append(atoms, atom{w[0], w[1], 1})
+		case len(atoms) > 0 && atoms[len(atoms)-1].start == block.start:
+			atoms[len(atoms)-1].end = max(atoms[len(atoms)-1].end, w[1])
+			atoms[len(atoms)-1].tokens++
+		default:
+			atoms = append(atoms, atom{block.start, w[1], 1})
+		}
+	}
+	return atoms
+}
+
+// abbreviations are words whose trailing period does not end a sentence.
+var abbreviations = map[string]bool{
+	"e.g": true, "i.e": true, "cf": true, "vs": true, "mr": true, "mrs": true, "ms": true,
+	"dr": true, "prof": true, "st": true, "no": true, "fig": true, "p": true, "pp": true,
+}
+
+// sentenceEnds returns the offsets just past the end of every sentence in text.
+func sentenceEnds(text string) []int {
+	var ends []int
+	open := false
+	parse(text).forEachLine(text, func(offset int, line string, block *span) {
+		if block != nil && block.comment() {
+			return // a location marker belongs to the sentence that follows it
+		}
+		if block != nil {
+			// A block is one sentence: it ends whatever came before it and itself.
+			if !open {
+				ends = append(ends, offset)
+			}
+			open = true
+			return
+		}
+		if open {
+			ends = append(ends, offset)
+			open = false
+		}
+		if strings.TrimSpace(line) == "" {
+			ends = append(ends, offset)
+			return
+		}
+		for i := 0; i < len(line); i++ {
+			if c := line[i]; c != '.' && c != '!' && c != '?' {
+				continue
+			}
+			j := i + 1
+			for j < len(line) && strings.IndexByte(`"')]*_`, line[j]) != -1 {
+				j++
+			}
+			if j < len(line) && line[j] != ' ' && line[j] != '\t' && line[j] != '\n' && line[j] != '\r' {
+				continue
+			}
+			if line[i] == '.' && abbreviations[strings.ToLower(lastWord(line[:i]))] {
+				continue
+			}
+			if next := nextNonSpace(text[offset+j:]); next != 0 && unicode.IsLower(next) {
+				continue
+			}
+			ends = append(ends, offset+j)
+		}
+	})
+
+	// Drop empty sentences, e.g. the blank line after a sentence that already ended.
+	sort.Ints(ends)
+	var out []int
+	last := 0
+	for _, end := range ends {
+		if end > last && strings.TrimSpace(text[last:end]) != "" {
+			out = append(out, end)
+			last = end
+		}
+	}
+	return out
+}
+
+// lastWord returns the word directly before the end of s.
+func lastWord(s string) string {
+	i := strings.LastIndexAny(s, " \t\n(\"'")
+	return s[i+1:]
+}
+
+// nextNonSpace returns the first non-whitespace rune of s, or 0.
+func nextNonSpace(s string) rune {
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		if !unicode.IsSpace(r) {
+			return r
+		}
+		s = s[size:]
+	}
+	return 0
+}
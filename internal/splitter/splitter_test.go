@@ -0,0 +1,173 @@
+package splitter
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// trimmed drops the surrounding whitespace and the empty chunks, as split does.
+func trimmed(chunks []string) []string {
+	var out []string
+	for _, c := range chunks {
+		if c = strings.TrimSpace(c); c != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func TestDelimiter(t *testing.T) {
+	got := Delimiter("one\n###\ntwo\n###\n", "###")
+	want := []string{"one\n", "\ntwo\n", "\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Delimiter() = %q, want %q", got, want)
+	}
+}
+
+func TestRegex(t *testing.T) {
+	re := regexp.MustCompile(`(?m)^\* \* \*$`)
+	got := trimmed(Regex("one\n* * *\ntwo\n* * *\nthree", re))
+	want := []string{"one", "two", "three"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Regex() = %q, want %q", got, want)
+	}
+}
+
+func TestHeadings(t *testing.T) {
+	text := "Intro\n# Title\nA\n## Part\nB\n### Detail\nC\n```\n# not a heading\n```\n#hashtag\n"
+	tests := []struct {
+		level int
+		want  []string
+	}{
+		{1, []string{"Intro", "# Title\nA\n## Part\nB\n### Detail\nC\n```\n# not a heading\n```\n#hashtag"}},
+		{2, []string{"Intro", "# Title\nA", "## Part\nB\n### Detail\nC\n```\n# not a heading\n```\n#hashtag"}},
+		{3, []string{"Intro", "# Title\nA", "## Part\nB", "### Detail\nC\n```\n# not a heading\n```\n#hashtag"}},
+	}
+	for _, tt := range tests {
+		if got := trimmed(Headings(text, tt.level)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Headings(level %d) = %q, want %q", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestHeadingsKeepsText(t *testing.T) {
+	text := "# A\none\n\n# B\ntwo\n"
+	if got := strings.Join(Headings(text, 1), ""); got != text {
+		t.Errorf("Headings() chunks join to %q, want %q", got, text)
+	}
+}
+
+func TestParagraphs(t *testing.T) {
+	text := "First line\nsecond line\n\n\nNext\n\n```go\nfunc f() {\n\n}\n```\n\nLast"
+	got := trimmed(Paragraphs(text))
+	want := []string{"First line\nsecond line", "Next", "```go\nfunc f() {\n\n}\n```", "Last"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Paragraphs() = %q, want %q", got, want)
+	}
+}
+
+func TestSentences(t *testing.T) {
+	text := "One is here. Two, e.g. with an abbreviation! Three?\nFour ends \"quoted.\" five stays lowercase.\n\nSix has no period\n\nSeven. Eight."
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{1, []string{
+			"One is here.",
+			"Two, e.g. with an abbreviation!",
+			"Three?",
+			"Four ends \"quoted.\" five stays lowercase.",
+			"Six has no period",
+			"Seven.",
+			"Eight.",
+		}},
+		{3, []string{
+			"One is here. Two, e.g. with an abbreviation! Three?",
+			"Four ends \"quoted.\" five stays lowercase.\n\nSix has no period\n\nSeven.",
+			"Eight.",
+		}},
+	}
+	for _, tt := range tests {
+		if got := trimmed(Sentences(text, tt.n)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Sentences(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSentencesCodeFence(t *testing.T) {
+	text := "Before.\n```\nx := 1. Y := 2.\n```\nAfter."
+	got := trimmed(Sentences(text, 1))
+	want := []string{"Before.", "```\nx := 1. Y := 2.\n```", "After."}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Sentences() = %q, want %q", got, want)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	text := "a b c d e f g"
+	tests := []struct {
+		max, overlap int
+		want         []string
+	}{
+		{3, 0, []string{"a b c", "d e f", "g"}},
+		{3, 1, []string{"a b c", "c d e", "e f g"}},
+		{4, 2, []string{"a b c d", "c d e f", "e f g"}},
+		{10, 3, []string{"a b c d e f g"}},
+	}
+	for _, tt := range tests {
+		if got := Tokens(text, tt.max, tt.overlap); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokens(%d, %d) = %q, want %q", tt.max, tt.overlap, got, tt.want)
+		}
+	}
+}
+
+func TestTokensKeepsCommentsWhole(t *testing.T) {
+	text := "<!-- zettelflow:location page 3 -->\none two\nthree"
+	got := Tokens(text, 2, 0)
+	want := []string{"<!-- zettelflow:location page 3 -->\none", "two\nthree"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokens() = %q, want %q", got, want)
+	}
+}
+
+func TestNew(t *testing.T) {
+	opts := Options{Delimiter: "###", HeadingLevel: 2, Sentences: 2, MaxTokens: 3, Overlap: 1, Pattern: "^---$"}
+	tests := []struct {
+		spec string
+		text string
+		want []string
+	}{
+		{"", "a###b", []string{"a", "b"}},
+		{"delimiter", "a###b", []string{"a", "b"}},
+		{"delimiter:|", "a|b###c", []string{"a", "b###c"}},
+		{"heading", "# A\n## B\n### C", []string{"# A", "## B\n### C"}},
+		{"heading:3", "# A\n## B\n### C", []string{"# A", "## B", "### C"}},
+		{"paragraph", "a\n\nb", []string{"a", "b"}},
+		{"sentence", "A. B. C.", []string{"A. B.", "C."}},
+		{"sentence:1", "A. B.", []string{"A.", "B."}},
+		{"tokens", "a b c d e", []string{"a b c", "c d e"}},
+		{"tokens:2", "a b c", []string{"a b", "b c"}},
+		{"regex", "a\n---\nb", []string{"a", "b"}},
+		{"regex:x+", "axxbxc", []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		split, err := New(tt.spec, opts)
+		if err != nil {
+			t.Errorf("New(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if got := trimmed(split(tt.text)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("New(%q)(%q) = %q, want %q", tt.spec, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for _, spec := range []string{"unknown", "heading:0", "heading:7", "heading:x", "sentence:0", "tokens:1", "regex:(", "regex"} {
+		if _, err := New(spec, Options{MaxTokens: 3, Overlap: 1}); err == nil {
+			t.Errorf("New(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package splitter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// streamLimit is how much text DelimiterStream holds once it has seen a delimiter that
+// does not cut, before it cuts at the last delimiter regardless. A variable for tests.
+var streamLimit = 16 << 20
+
+// DelimiterStream splits the text read from r at every occurrence of delimiter, like
+// Delimiter, but passes each chunk to emit as soon as it is complete, so that the text is
+// never held in memory as a whole: only the chunk being read is.
+//
+// The text read since the last cut is cut at blank lines that follow a delimiter. No
+// later line can change the block structure before a blank line, so the chunks are those
+// of Delimiter, except that text following a delimiter in the middle of a line is parsed
+// as if it started a line. While the delimiters read are inside a protected block, such
+// as an unclosed code fence, the text is parsed again only once it has doubled, and once
+// it exceeds 16 MB it is cut at its last delimiter, protected or not. An error from emit
+// stops the split and is returned.
+func DelimiterStream(r io.Reader, delimiter string, emit func(chunk string) error) error {
+	if delimiter == "" {
+		return fmt.Errorf("delimiter strategy: empty delimiter")
+	}
+	reader := bufio.NewReaderSize(r, 64*1024)
+	var buf strings.Builder
+	searched := 0    // bytes of buf already searched for the delimiter
+	pending := false // whether buf holds a delimiter that may be a separator
+	parsed := 0      // length of buf when it was last parsed without a cut
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		buf.WriteString(line)
+		if !pending {
+			// A delimiter spanning lines may start in what was searched before.
+			from := max(0, searched-len(delimiter)+1)
+			pending = strings.Contains(buf.String()[from:], delimiter)
+			searched = buf.Len()
+		}
+		if err == io.EOF {
+			break
+		}
+		full := buf.Len() > streamLimit
+		if !pending || !full && (strings.TrimSpace(line) != "" || buf.Len() < 2*parsed) {
+			continue
+		}
+		text := buf.String()
+		chunks := Delimiter(text, delimiter)
+		if len(chunks) == 1 && full {
+			i := strings.LastIndex(text, delimiter)
+			chunks = []string{text[:i], text[i+len(delimiter):]}
+		}
+		if len(chunks) == 1 {
+			// Every delimiter so far is protected; wait for more text before parsing again.
+			parsed, searched, pending = buf.Len(), buf.Len(), false
+			continue
+		}
+		for _, chunk := range chunks[:len(chunks)-1] {
+			if err := emit(chunk); err != nil {
+				return err
+			}
+		}
+		rest := chunks[len(chunks)-1]
+		buf.Reset()
+		buf.WriteString(rest)
+		searched, pending, parsed = buf.Len(), false, 0
+	}
+	for _, chunk := range Delimiter(buf.String(), delimiter) {
+		if err := emit(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package splitter
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func streamed(t *testing.T, text, delimiter string) []string {
+	t.Helper()
+	var chunks []string
+	err := DelimiterStream(iotest.OneByteReader(strings.NewReader(text)), delimiter, func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("DelimiterStream() error = %v", err)
+	}
+	return chunks
+}
+
+func TestDelimiterStream(t *testing.T) {
+	tests := []struct {
+		name, text, delimiter string
+	}{
+		{"simple", "one\n###\ntwo\n###\n", "###"},
+		{"blank lines", "one\n\n###\n\ntwo\n\n###\n\nthree\n", "###"},
+		{"blocks", structured, "###"},
+		{"blocks repeated", structured + "\n\n" + structured + "\n", "###"},
+		{"open fence", "one\n###\n\n```\n###\n\nstill code\n###\n```\n\n###\ntwo", "###"},
+		{"unclosed fence", "one\n###\n\n```\n" + strings.Repeat("code\n###\n\n", 200), "###"},
+		{"closed late", "```\n" + strings.Repeat("code\n###\n\n", 200) + "```\n\n###\n\nafter\n###\n\nlast", "###"},
+		{"multi-line delimiter", "one\n\n--\n--\n\ntwo\n\n--\n--\nthree", "--\n--"},
+		{"no delimiter", "one\n\ntwo\n", "###"},
+		{"empty", "", "###"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := streamed(t, tt.text, tt.delimiter)
+			want := Delimiter(tt.text, tt.delimiter)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("DelimiterStream() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestDelimiterStreamEmitsEarly(t *testing.T) {
+	broken := errors.New("broken")
+	reader := io.MultiReader(strings.NewReader("one\n###\n\ntwo\n###\n\n"), iotest.ErrReader(broken))
+	var chunks []string
+	err := DelimiterStream(reader, "###", func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if !errors.Is(err, broken) {
+		t.Errorf("DelimiterStream() error = %v, want %v", err, broken)
+	}
+	if want := []string{"one\n", "\n\ntwo\n"}; !reflect.DeepEqual(chunks, want) {
+		t.Errorf("DelimiterStream() emitted %q before the read error, want %q", chunks, want)
+	}
+}
+
+func TestDelimiterStreamErrors(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+	err := DelimiterStream(strings.NewReader("one\n###\n\ntwo\n###\n\nthree"), "###", func(string) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("DelimiterStream() = %v after %d calls, want %v after 1", err, calls, stop)
+	}
+	if err := DelimiterStream(strings.NewReader("text"), "", func(string) error { return nil }); err == nil {
+		t.Error("DelimiterStream() with an empty delimiter succeeded")
+	}
+}
+
+func TestDelimiterStreamUnclosedFence(t *testing.T) {
+	// Each delimiter in the fence used to make the whole text be parsed again.
+	text := "intro\n###\n\n```\n" + strings.Repeat("code\n###\n\n", 100000)
+	start := time.Now()
+	var chunks []string
+	err := DelimiterStream(strings.NewReader(text), "###", func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("DelimiterStream() of %d bytes in an unclosed fence took %v", len(text), elapsed)
+	}
+	if want := Delimiter(text, "###"); !reflect.DeepEqual(chunks, want) {
+		t.Errorf("DelimiterStream() = %d chunks, want the %d of Delimiter", len(chunks), len(want))
+	}
+}
+
+func TestDelimiterStreamLimit(t *testing.T) {
+	defer func(limit int) { streamLimit = limit }(streamLimit)
+	streamLimit = 100
+
+	text := "```\n" + strings.Repeat("code\n###\n\n", 20)
+	chunks := streamed(t, text, "###")
+	if len(chunks) < 2 {
+		t.Fatalf("DelimiterStream() = %q, want the fence cut once it exceeds the limit", chunks)
+	}
+	for _, chunk := range chunks {
+		if len(chunk) > 2*streamLimit {
+			t.Errorf("DelimiterStream() emitted a chunk of %d bytes, over the limit of %d", len(chunk), streamLimit)
+		}
+	}
+	if got := strings.Join(chunks, "###"); got != text {
+		t.Errorf("DelimiterStream() chunks joined = %q, want the text", got)
+	}
+}